@@ -0,0 +1,127 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/tango-contrib/session"
+)
+
+type asyncWrite struct {
+	id  session.Id
+	key string
+	bs  []byte
+}
+
+// asyncWriter runs the background workers of SetAsync, they are started
+// on first use.
+type asyncWriter struct {
+	start sync.Once
+	lock  sync.RWMutex
+	queue chan asyncWrite
+	wg    sync.WaitGroup
+}
+
+// SetAsync sets a value like Set but returns once the value is serialized,
+// the write itself happens on a background worker. Failed writes are
+// reported to Options.OnError, and kept for replay if
+// Options.ReplayBufferSize is set. When AsyncQueueSize writes are pending
+// ErrAsyncQueueFull is returned instead of blocking. Close waits for
+// pending writes.
+func (s *SSDBStore) SetAsync(id session.Id, key string, val interface{}) error {
+	if err := s.validateId(id); err != nil {
+		return err
+	}
+
+	bs, err := s.serializeFor(id, val)
+	if err != nil {
+		return err
+	}
+
+	s.async.start.Do(func() {
+		queue := make(chan asyncWrite, s.AsyncQueueSize)
+		s.async.queue = queue
+		for i := 0; i < s.AsyncWorkers; i++ {
+			s.async.wg.Add(1)
+			go s.asyncWorker(queue)
+		}
+	})
+
+	s.async.lock.RLock()
+	defer s.async.lock.RUnlock()
+	if s.async.queue == nil {
+		return ErrClosed
+	}
+	s.cache.forget(id, key)
+	s.stale.forget(id, key)
+	select {
+	case s.async.queue <- asyncWrite{id, key, bs}:
+		return nil
+	default:
+		return ErrAsyncQueueFull
+	}
+}
+
+func (s *SSDBStore) asyncWorker(queue <-chan asyncWrite) {
+	defer s.async.wg.Done()
+	for w := range queue {
+		if err := s.writeAsync(w); err != nil {
+			s.logger().Errorf("ssdb async HSET %s failed: %s", string(w.id)+":"+w.key, err)
+			s.retainFailed(w, err)
+			s.reportError("set", w.id, w.key, err)
+		}
+	}
+}
+
+func (s *SSDBStore) writeAsync(w asyncWrite) (err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	defer s.cache.forget(w.id, w.key)
+
+	return s.write(c, w.id, w.key, w.bs)
+}
+
+// flush stops accepting async writes and waits for the pending ones.
+func (a *asyncWriter) flush() {
+	a.start.Do(func() {})
+	a.lock.Lock()
+	queue := a.queue
+	a.queue = nil
+	a.lock.Unlock()
+	if queue != nil {
+		close(queue)
+	}
+	a.wg.Wait()
+}
+
+func (s *SSDBStore) reportError(op string, id session.Id, key string, err error) {
+	if s.OnError != nil {
+		s.OnError(op, id, key, err)
+	}
+}
+
+// Close stops the background TTL repair, waits for pending async writes
+// and closes the connection pools. Afterwards operations fail with
+// ErrClosed. Closing a closed store does nothing.
+func (s *SSDBStore) Close() error {
+	if !atomic.CompareAndSwapUint32(&s.closing, 0, 1) {
+		return nil
+	}
+	s.ttlRepair.stopLoop()
+	s.async.flush()
+	atomic.StoreUint32(&s.closed, 1)
+	s.pool.Close()
+	if s.standby != nil {
+		s.standby.pool.Close()
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestSetAsync(t *testing.T) {
+	var lock sync.Mutex
+	var failed []string
+	store, b := newMemStore(t, Options{
+		OnError: func(op string, id session.Id, key string, err error) {
+			lock.Lock()
+			failed = append(failed, op+" "+string(id)+":"+key)
+			lock.Unlock()
+		},
+	})
+
+	for i := 0; i < 20; i++ {
+		expect(t, store.SetAsync("id", fmt.Sprint(i), i), nil)
+	}
+	refute(t, store.SetAsync("id", "bad", make(chan int)), nil)
+	expect(t, store.Close(), nil)
+
+	for i := 0; i < 20; i++ {
+		_, ok := b.field("id", fmt.Sprint(i))
+		expect(t, ok, true)
+	}
+	expect(t, len(failed), 0)
+	expect(t, store.SetAsync("id", "late", 1), ErrClosed)
+}
+
+func TestSetAsyncReportsErrors(t *testing.T) {
+	errs := make(chan string, 1)
+	store, b := newMemStore(t, Options{
+		OnError: func(op string, id session.Id, key string, err error) {
+			errs <- op + " " + string(id) + ":" + key
+		},
+	})
+	b.setDown(true)
+
+	expect(t, store.SetAsync("id", "a", "1"), nil)
+	expect(t, <-errs, "set id:a")
+	expect(t, store.Close(), nil)
+}
+
+func TestSetAsyncQueueFull(t *testing.T) {
+	store, b := newMemStore(t, Options{AsyncWorkers: 1, AsyncQueueSize: 1})
+	gate := b.block("hset")
+
+	// the only worker blocks on the first write, the second one fills
+	// the queue
+	expect(t, store.SetAsync("id", "a", 1), nil)
+	for b.count("hset") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	expect(t, store.SetAsync("id", "b", 2), nil)
+	expect(t, store.SetAsync("id", "c", 3), ErrAsyncQueueFull)
+
+	close(gate)
+	expect(t, store.Close(), nil)
+	_, ok := b.field("id", "b")
+	expect(t, ok, true)
+}
+
+func TestClose(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	expect(t, store.Set("id", "a", "1"), nil)
+	connects := b.count("connect")
+
+	expect(t, store.Close(), nil)
+	expect(t, store.Close(), nil)
+	expect(t, b.count("close"), 1)
+
+	expect(t, store.Set("id", "a", "2"), ErrClosed)
+	expect(t, store.Get("id", "a"), nil)
+	_, err := store.ExistE("id")
+	expect(t, err, ErrClosed)
+	expect(t, store.Ping(), ErrClosed)
+	expect(t, store.SetAsync("id", "a", "2"), ErrClosed)
+	expect(t, b.count("connect"), connects)
+}
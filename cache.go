@@ -0,0 +1,256 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// readCache keeps values recently read by this process for a short time.
+// It is only invalidated by writes going through the same store, so
+// writes of other processes stay invisible until entries expire. A nil
+// *readCache caches nothing.
+//
+// Every forget stamps the session with a new generation, and put drops
+// values read before the latest stamp of their session, so a read racing
+// a write can not cache the old value once the writer forgot the field
+// again after writing it. Writes to other sessions do not matter.
+type readCache struct {
+	ttl time.Duration
+
+	hits, misses uint64
+
+	lock     sync.Mutex
+	entries  map[session.Id]map[string]cacheEntry
+	sweepAt  int
+	gen      uint64
+	versions map[session.Id]uint64 // generation of the last forget
+	floor    uint64                // reads before it are not cached
+}
+
+const (
+	minCacheSweep = 64
+
+	// maxVersions bounds the sessions whose last forget is remembered.
+	// Beyond it they are dropped, and reads which started before are
+	// not cached, as they could have raced any of those forgets.
+	maxVersions = 1024
+)
+
+func newReadCache(ttl time.Duration) *readCache {
+	return &readCache{
+		ttl:      ttl,
+		entries:  make(map[session.Id]map[string]cacheEntry),
+		sweepAt:  minCacheSweep,
+		versions: make(map[session.Id]uint64),
+	}
+}
+
+func (r *readCache) get(id session.Id, key string, now time.Time) (interface{}, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, ok := r.entries[id][key]
+	if !ok || !now.Before(e.expires) {
+		atomic.AddUint64(&r.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&r.hits, 1)
+	return e.value, true
+}
+
+// CacheStats returns how many Gets the read cache answered and how many
+// it had to pass on to the backend, both zero without ReadCacheTTL.
+func (s *SSDBStore) CacheStats() (hits, misses uint64) {
+	if s.cache == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&s.cache.hits), atomic.LoadUint64(&s.cache.misses)
+}
+
+// CacheHitRatio returns the share of Gets answered by the read cache,
+// zero before the first Get.
+func (s *SSDBStore) CacheHitRatio() float64 {
+	hits, misses := s.CacheStats()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+// generation returns the token put needs, take it before reading.
+func (r *readCache) generation() uint64 {
+	if r == nil {
+		return 0
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.gen
+}
+
+func (r *readCache) put(id session.Id, key string, value interface{}, now time.Time, gen uint64) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if gen < r.floor || r.versions[id] > gen {
+		return
+	}
+	fields, ok := r.entries[id]
+	if !ok {
+		if len(r.entries) >= r.sweepAt {
+			r.sweep(now)
+		}
+		fields = make(map[string]cacheEntry)
+		r.entries[id] = fields
+	}
+	fields[key] = cacheEntry{value: value, expires: now.Add(r.ttl)}
+}
+
+// sweep drops expired entries, it must be called with the lock held.
+func (r *readCache) sweep(now time.Time) {
+	for id, fields := range r.entries {
+		for key, e := range fields {
+			if !now.Before(e.expires) {
+				delete(fields, key)
+			}
+		}
+		if len(fields) == 0 {
+			delete(r.entries, id)
+		}
+	}
+	r.sweepAt = 2 * len(r.entries)
+	if r.sweepAt < minCacheSweep {
+		r.sweepAt = minCacheSweep
+	}
+}
+
+func (r *readCache) forget(id session.Id, key string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	delete(r.entries[id], key)
+	r.stamp(id)
+	r.lock.Unlock()
+}
+
+func (r *readCache) forgetAll(id session.Id) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	delete(r.entries, id)
+	r.stamp(id)
+	r.lock.Unlock()
+}
+
+// stamp records a forget of id, it must be called with the lock held.
+func (r *readCache) stamp(id session.Id) {
+	if len(r.versions) >= maxVersions {
+		r.versions = make(map[session.Id]uint64)
+		r.floor = r.gen + 1
+	}
+	r.gen++
+	r.versions[id] = r.gen
+}
+
+type staleKey struct {
+	id  session.Id
+	key string
+}
+
+// staleCache holds the most recently read values, evicting the oldest
+// once size entries are held. A nil *staleCache caches nothing.
+type staleCache struct {
+	lock    sync.Mutex
+	size    int
+	order   *list.List // of staleEntry, oldest first
+	entries map[staleKey]*list.Element
+}
+
+type staleEntry struct {
+	key   staleKey
+	value interface{}
+}
+
+func newStaleCache(size int) *staleCache {
+	return &staleCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[staleKey]*list.Element, size),
+	}
+}
+
+func (r *staleCache) get(id session.Id, key string) (interface{}, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	e, ok := r.entries[staleKey{id, key}]
+	if !ok {
+		return nil, false
+	}
+	return e.Value.(staleEntry).value, true
+}
+
+func (r *staleCache) put(id session.Id, key string, value interface{}) {
+	if r == nil {
+		return
+	}
+	k := staleKey{id, key}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if e, ok := r.entries[k]; ok {
+		e.Value = staleEntry{k, value}
+		return
+	}
+	if r.order.Len() >= r.size {
+		oldest := r.order.Remove(r.order.Front()).(staleEntry)
+		delete(r.entries, oldest.key)
+	}
+	r.entries[k] = r.order.PushBack(staleEntry{k, value})
+}
+
+func (r *staleCache) forget(id session.Id, key string) {
+	if r == nil {
+		return
+	}
+	k := staleKey{id, key}
+	r.lock.Lock()
+	if e, ok := r.entries[k]; ok {
+		r.order.Remove(e)
+		delete(r.entries, k)
+	}
+	r.lock.Unlock()
+}
+
+func (r *staleCache) forgetAll(id session.Id) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	for k, e := range r.entries {
+		if k.id == id {
+			r.order.Remove(e)
+			delete(r.entries, k)
+		}
+	}
+	r.lock.Unlock()
+}
@@ -0,0 +1,220 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestReadCache(t *testing.T) {
+	store, b := newMemStore(t, Options{ReadCacheTTL: time.Second})
+	clock := newFakeClock()
+	store.clock = clock
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, b.count("hget"), 1)
+
+	clock.Advance(999 * time.Millisecond)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, b.count("hget"), 1)
+
+	clock.Advance(time.Millisecond)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, b.count("hget"), 2)
+
+	// writes through the store invalidate the cached field
+	expect(t, store.Set("id", "a", "2"), nil)
+	expect(t, store.Get("id", "a"), "2")
+	expect(t, b.count("hget"), 3)
+
+	expect(t, store.Del("id", "a"), true)
+	expect(t, store.Get("id", "a"), nil)
+	expect(t, b.count("hget"), 4)
+}
+
+func TestCacheStats(t *testing.T) {
+	store, _ := newMemStore(t, Options{ReadCacheTTL: time.Second})
+	store.clock = newFakeClock()
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	store.Get("id", "a")
+	hits, misses := store.CacheStats()
+	expect(t, hits, uint64(0))
+	expect(t, misses, uint64(1))
+
+	store.Get("id", "a")
+	store.Get("id", "a")
+	store.Get("id", "b")
+	hits, misses = store.CacheStats()
+	expect(t, hits, uint64(2))
+	expect(t, misses, uint64(2))
+	expect(t, store.CacheHitRatio(), 0.5)
+
+	uncached, _ := newMemStore(t, Options{})
+	uncached.Get("id", "a")
+	hits, misses = uncached.CacheStats()
+	expect(t, hits+misses, uint64(0))
+	expect(t, uncached.CacheHitRatio(), float64(0))
+}
+
+func TestGetStale(t *testing.T) {
+	store, b := newMemStore(t, Options{StaleCacheSize: 2})
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Set("id", "b", "2"), nil)
+	expect(t, store.Set("id", "c", "3"), nil)
+	for _, key := range []string{"a", "b", "c"} {
+		v, stale := store.GetStale("id", key)
+		expect(t, stale, false)
+		refute(t, v, nil)
+	}
+
+	b.setDown(true)
+	v, stale := store.GetStale("id", "c")
+	expect(t, v, "3")
+	expect(t, stale, true)
+	v, stale = store.GetStale("id", "b")
+	expect(t, v, "2")
+	expect(t, stale, true)
+
+	// evicted by the size bound
+	v, stale = store.GetStale("id", "a")
+	expect(t, v, nil)
+	expect(t, stale, false)
+
+	// writes keep failing
+	refute(t, store.Set("id", "c", "4"), nil)
+	v, _ = store.GetStale("id", "c")
+	expect(t, v, nil)
+
+	// a client from the pool whose command fails falls back as well
+	b.setDown(false)
+	for _, err := range []error{
+		errors.New("read tcp 127.0.0.1:8888: i/o timeout"),
+		errors.New("client read error: use of closed network connection"),
+	} {
+		b.failWith("hget", err)
+		v, stale = store.GetStale("id", "b")
+		expect(t, v, "2")
+		expect(t, stale, true)
+	}
+	b.failWith("hget", errors.New("access ssdb error, code is [error]"))
+	v, stale = store.GetStale("id", "b")
+	expect(t, v, nil)
+	expect(t, stale, false)
+}
+
+// pausingLogger holds the first Get logging a large read, which happens
+// after its HGET returned, until release is closed.
+type pausingLogger struct {
+	*memLogger
+	once    sync.Once
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (l *pausingLogger) Infof(format string, v ...interface{}) {
+	if strings.Contains(format, "large value") && v[1] == "read" {
+		l.once.Do(func() {
+			close(l.reading)
+			<-l.release
+		})
+	}
+	l.memLogger.Infof(format, v...)
+}
+
+func TestReadCacheRacingSet(t *testing.T) {
+	store, _ := newMemStore(t, Options{ReadCacheTTL: time.Minute, LargeValueLogThreshold: 1})
+	expect(t, store.Set("id", "a", "old"), nil)
+	logger := &pausingLogger{
+		memLogger: newMemLogger(),
+		reading:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	store.Logger = logger
+
+	got := make(chan interface{})
+	go func() { got <- store.Get("id", "a") }()
+	<-logger.reading
+
+	// the Set lands between the HGET of the Get and its cache put
+	expect(t, store.Set("id", "a", "new"), nil)
+	close(logger.release)
+	expect(t, <-got, "old")
+
+	expect(t, store.Get("id", "a"), "new")
+}
+
+func TestReadCacheUnrelatedWrite(t *testing.T) {
+	store, b := newMemStore(t, Options{ReadCacheTTL: time.Minute, LargeValueLogThreshold: 1})
+	expect(t, store.Set("id", "a", "1"), nil)
+	logger := &pausingLogger{
+		memLogger: newMemLogger(),
+		reading:   make(chan struct{}),
+		release:   make(chan struct{}),
+	}
+	store.Logger = logger
+
+	got := make(chan interface{})
+	go func() { got <- store.Get("id", "a") }()
+	<-logger.reading
+
+	// a write to another session does not keep the read from the cache
+	expect(t, store.Set("other", "a", "2"), nil)
+	close(logger.release)
+	expect(t, <-got, "1")
+
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, b.count("hget"), 1)
+}
+
+func TestReadCacheVersionsBounded(t *testing.T) {
+	r := newReadCache(time.Minute)
+	now := time.Now()
+	gen := r.generation()
+	for i := 0; i < maxVersions+1; i++ {
+		r.forget(session.Id(fmt.Sprint(i)), "a")
+	}
+	expect(t, len(r.versions) <= maxVersions, true)
+
+	// forgotten stamps are unknown, so older reads are not cached
+	r.put("unrelated", "a", "1", now, gen)
+	_, ok := r.get("unrelated", "a", now)
+	expect(t, ok, false)
+	r.put("unrelated", "a", "1", now, r.generation())
+	_, ok = r.get("unrelated", "a", now)
+	expect(t, ok, true)
+}
+
+func TestStaleCacheForget(t *testing.T) {
+	store, b := newMemStore(t, Options{StaleCacheSize: 3})
+	expect(t, store.Set("id", "a", "a"), nil)
+	expect(t, store.Get("id", "a"), "a")
+
+	// rewriting a field frees its slot instead of leaving it behind, so
+	// filling the cache later does not evict the fresh value
+	expect(t, store.Set("id", "a", "A"), nil)
+	expect(t, store.Get("id", "a"), "A")
+	for _, key := range []string{"b", "c"} {
+		expect(t, store.Set("id", key, key), nil)
+		expect(t, store.Get("id", key), key)
+	}
+
+	b.setDown(true)
+	for key, want := range map[string]string{"a": "A", "b": "b", "c": "c"} {
+		v, stale := store.GetStale("id", key)
+		expect(t, v, want)
+		expect(t, stale, true)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+// checksumMarker starts a value made of a big endian CRC32 of the payload
+// followed by the payload itself. See binaryMarker for why the marker can
+// not clash with gob data.
+const checksumMarker byte = 0x81
+
+const checksumHeader = 1 + 4
+
+func addChecksum(payload []byte) []byte {
+	bs := make([]byte, checksumHeader+len(payload))
+	bs[0] = checksumMarker
+	binary.BigEndian.PutUint32(bs[1:], crc32.ChecksumIEEE(payload))
+	copy(bs[checksumHeader:], payload)
+	return bs
+}
+
+// verifyChecksum checks a value starting with checksumMarker and returns
+// its payload.
+func verifyChecksum(bs []byte) ([]byte, error) {
+	if len(bs) < checksumHeader {
+		return nil, errors.New("malformed checksum header")
+	}
+	payload := bs[checksumHeader:]
+	if binary.BigEndian.Uint32(bs[1:]) != crc32.ChecksumIEEE(payload) {
+		return nil, ErrChecksumMismatch
+	}
+	return payload, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	store, b := newMemStore(t, Options{Checksum: true})
+
+	expect(t, store.Set("id", "a", "hello"), nil)
+	raw, _ := b.field("id", "a")
+	expect(t, raw[0], checksumMarker)
+	expect(t, store.Get("id", "a"), "hello")
+
+	// flip a bit of the payload
+	tampered := []byte(raw)
+	tampered[len(tampered)-1] ^= 1
+	_, err := store.deserialize(tampered)
+	expect(t, err, ErrChecksumMismatch)
+
+	b.lock.Lock()
+	b.hashes["id"]["a"] = string(tampered)
+	b.lock.Unlock()
+	expect(t, store.Get("id", "a"), nil)
+	_, _, err = store.Peek("id", "a")
+	expect(t, err, ErrChecksumMismatch)
+
+	// values written without a checksum stay readable
+	store.Checksum = false
+	expect(t, store.Set("id", "b", "plain"), nil)
+	store.Checksum = true
+	expect(t, store.Get("id", "b"), "plain")
+}
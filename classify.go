@@ -0,0 +1,127 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/seefan/gossdb"
+)
+
+// backendErrorKinds maps substrings of the lower cased client messages to
+// their kind, the first match wins. gossdb only reports plain strings.
+var backendErrorKinds = []struct {
+	substr string
+	kind   error
+}{
+	{"timeout", ErrTimeout},
+	{"timed out", ErrTimeout},
+	{"noauth", ErrAuthRequired},
+	{"auth required", ErrAuthRequired},
+	{"authentication required", ErrAuthRequired},
+	{"not_found", ErrNotFound},
+	{"not found", ErrNotFound},
+	{"closed", ErrConnectionClosed},
+	{"broken pipe", ErrConnectionClosed},
+	{"connection reset", ErrConnectionClosed},
+	{"eof", ErrConnectionClosed},
+}
+
+// classify wraps an error of the SSDB client as a BackendError, errors
+// already classified pass unchanged.
+func classify(err error) error {
+	if err == nil {
+		return err
+	}
+	var be *BackendError
+	if errors.As(err, &be) {
+		return err
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return &BackendError{Kind: ErrTimeout, Err: err}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, k := range backendErrorKinds {
+		if strings.Contains(msg, k.substr) {
+			return &BackendError{Kind: k.kind, Err: err}
+		}
+	}
+	return &BackendError{Kind: ErrUnknown, Err: err}
+}
+
+// classifiedClient classifies the errors of every command of client, so
+// all methods of the store report BackendErrors alike.
+type classifiedClient struct {
+	client
+}
+
+func (c classifiedClient) Hset(setName, key string, value interface{}) error {
+	return classify(c.client.Hset(setName, key, value))
+}
+
+func (c classifiedClient) Hget(setName, key string) (gossdb.Value, error) {
+	v, err := c.client.Hget(setName, key)
+	return v, classify(err)
+}
+
+func (c classifiedClient) Hdel(setName, key string) error {
+	return classify(c.client.Hdel(setName, key))
+}
+
+func (c classifiedClient) Hexists(setName, key string) (bool, error) {
+	ok, err := c.client.Hexists(setName, key)
+	return ok, classify(err)
+}
+
+func (c classifiedClient) Hsize(setName string) (int64, error) {
+	n, err := c.client.Hsize(setName)
+	return n, classify(err)
+}
+
+func (c classifiedClient) HgetAll(setName string) (map[string]gossdb.Value, error) {
+	m, err := c.client.HgetAll(setName)
+	return m, classify(err)
+}
+
+func (c classifiedClient) Hlist(nameStart, nameEnd string, limit int64) ([]string, error) {
+	names, err := c.client.Hlist(nameStart, nameEnd, limit)
+	return names, classify(err)
+}
+
+func (c classifiedClient) Del(key string) error {
+	return classify(c.client.Del(key))
+}
+
+func (c classifiedClient) MultiDel(key ...string) error {
+	return classify(c.client.MultiDel(key...))
+}
+
+func (c classifiedClient) Exists(key string) (bool, error) {
+	ok, err := c.client.Exists(key)
+	return ok, classify(err)
+}
+
+func (c classifiedClient) Expire(key string, ttl int64) (bool, error) {
+	ok, err := c.client.Expire(key, ttl)
+	return ok, classify(err)
+}
+
+func (c classifiedClient) Ttl(key string) (int64, error) {
+	ttl, err := c.client.Ttl(key)
+	return ttl, classify(err)
+}
+
+func (c classifiedClient) Qpush(name string, value ...interface{}) (int64, error) {
+	n, err := c.client.Qpush(name, value...)
+	return n, classify(err)
+}
+
+func (c classifiedClient) Do(args ...interface{}) ([]string, error) {
+	resp, err := c.client.Do(args...)
+	return resp, classify(err)
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// maxNamedClients bounds the memory of connections already named. Past
+// it the record starts over, which only costs renaming some connections.
+const maxNamedClients = 1024
+
+// clientNamer labels connections the first time the pool hands them out.
+type clientNamer struct {
+	lock        sync.Mutex
+	named       map[client]bool
+	next        int
+	unsupported uint32 // set once the server rejected the command
+}
+
+// name sends the client name command on c unless c already got a name.
+// Servers which do not know the command are not asked again.
+func (n *clientNamer) name(c client, prefix string) {
+	if atomic.LoadUint32(&n.unsupported) != 0 {
+		return
+	}
+
+	n.lock.Lock()
+	if n.named[c] {
+		n.lock.Unlock()
+		return
+	}
+	if n.named == nil || len(n.named) >= maxNamedClients {
+		n.named = make(map[client]bool)
+	}
+	n.named[c] = true
+	n.next++
+	name := prefix + "-" + strconv.Itoa(n.next)
+	n.lock.Unlock()
+
+	resp, err := c.Do("client", "setname", name)
+	if err == nil && (len(resp) == 0 || resp[0] != "ok") {
+		atomic.StoreUint32(&n.unsupported, 1)
+	}
+}
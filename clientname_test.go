@@ -0,0 +1,36 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClientName(t *testing.T) {
+	store, b := newMemStore(t, Options{ClientName: "shop"})
+	b.naming = true
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, strings.Join(b.names, ","), "shop-1,shop-2")
+}
+
+func TestClientNameUnsupported(t *testing.T) {
+	store, b := newMemStore(t, Options{ClientName: "shop"})
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, b.count("client"), 1)
+	expect(t, len(b.names), 0)
+}
+
+func TestClientNameUnset(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	b.naming = true
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, b.count("client"), 0)
+}
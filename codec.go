@@ -0,0 +1,228 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"unsafe"
+
+	"github.com/tango-contrib/session"
+)
+
+// Codec turns session values into the bytes stored in SSDB and back.
+// Values implementing encoding.BinaryMarshaler bypass GobCodec, but not
+// other codecs.
+type Codec interface {
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+// GobCodec encodes values with encoding/gob, preserving their concrete
+// types as long as they are registered, which Marshal does for the types
+// it sees. Structs must be passed as pointers and come back as pointers.
+type GobCodec struct {
+	// SafeLegacyStructs decodes structs stored by value, which older
+	// versions accepted, into a pointer to a copy instead of pointing at
+	// the decoder's memory through package unsafe. Such structs must be of
+	// a named type. Enable it while sessions written by those versions
+	// may still be read, see Options.SafeLegacyStructs.
+	SafeLegacyStructs bool
+}
+
+func (GobCodec) Marshal(value interface{}) ([]byte, error) {
+	if t := reflect.TypeOf(value); t != nil && t.Kind() == reflect.Struct {
+		return nil, fmt.Errorf("%w: got %s, store &value instead", ErrStructValue, t)
+	}
+
+	err := registerGobConcreteType(value)
+	if err != nil {
+		return nil, err
+	}
+
+	value = stripTransient(value)
+
+	var b bytes.Buffer
+	encoder := gob.NewEncoder(&b)
+
+	err = encoder.Encode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (g GobCodec) Unmarshal(byt []byte) (ptr interface{}, err error) {
+	b := bytes.NewBuffer(byt)
+	decoder := gob.NewDecoder(b)
+
+	var p interface{}
+	err = decoder.Decode(&p)
+	if err != nil {
+		return
+	}
+
+	v := reflect.ValueOf(p)
+	if v.Kind() == reflect.Struct && g.SafeLegacyStructs {
+		return legacyStruct(v)
+	}
+	if v.Kind() == reflect.Struct {
+		var pp interface{} = &p
+		datas := reflect.ValueOf(pp).Elem().InterfaceData()
+
+		sp := reflect.NewAt(v.Type(),
+			unsafe.Pointer(datas[1])).Interface()
+		ptr = sp
+	} else {
+		ptr = p
+	}
+	return
+}
+
+// legacyStruct returns a pointer to a copy of a struct decoded by value.
+func legacyStruct(v reflect.Value) (interface{}, error) {
+	if v.Type().Name() == "" {
+		return nil, fmt.Errorf("legacy struct value of unnamed type %s", v.Type())
+	}
+	pv := reflect.New(v.Type())
+	pv.Elem().Set(v)
+	return pv.Interface(), nil
+}
+
+// JSONCodec encodes values as JSON, readable by programs in any language.
+// JSON carries no Go types, so values come back the way encoding/json
+// decodes into an interface{}: structs and maps as map[string]interface{},
+// numbers as float64 and slices as []interface{}. Fields tagged
+// `session:"-"` are stored as their zero value, like with GobCodec.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(value interface{}) ([]byte, error) {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Struct {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		value = p.Interface()
+	}
+	return json.Marshal(stripTransient(value))
+}
+
+func (JSONCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// isGob reports whether codec is GobCodec, the only codec values of
+// encoding.BinaryMarshaler bypass, as they are opaque to others.
+func isGob(codec Codec) bool {
+	switch codec.(type) {
+	case GobCodec, *GobCodec:
+		return true
+	}
+	return false
+}
+
+// codec returns the codec of the store.
+func (c *SSDBStore) codec() Codec {
+	if c.Codec != nil {
+		return c.Codec
+	}
+	return GobCodec{SafeLegacyStructs: c.SafeLegacyStructs}
+}
+
+// codecFor returns the codec new values of a session are encoded with.
+func (c *SSDBStore) codecFor(id session.Id) Codec {
+	if c.CodecFor != nil {
+		if codec := c.CodecFor(id); codec != nil {
+			return codec
+		}
+	}
+	return c.codec()
+}
+
+// codecMarker starts a value encoded with another codec than the one of
+// the store, followed by the length of the codec's registered name, the
+// name and the payload. See binaryMarker for why the marker can not
+// clash with gob data, JSON never starts with such a byte either.
+const codecMarker byte = 0x84
+
+var (
+	codecsLock   sync.RWMutex
+	codecsByName = make(map[string]Codec)
+	codecNames   = make(map[reflect.Type]string)
+)
+
+func init() {
+	RegisterCodec("gob", GobCodec{})
+	RegisterCodec("json", JSONCodec{})
+}
+
+// RegisterCodec names a codec type, which is needed to use it through
+// Options.CodecFor: values record the name of their codec, so that
+// stores reading them pick the right one. The gob and json codecs are
+// registered already.
+func RegisterCodec(name string, codec Codec) error {
+	if name == "" || len(name) > 255 {
+		return fmt.Errorf("codec name %q must have 1 to 255 bytes", name)
+	}
+	t := reflect.TypeOf(codec)
+
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	if _, ok := codecsByName[name]; ok {
+		return fmt.Errorf("codec name %q is already registered", name)
+	}
+	if other, ok := codecNames[t]; ok {
+		return fmt.Errorf("codec %v is already registered as %q", t, other)
+	}
+	codecsByName[name] = codec
+	codecNames[t] = name
+	return nil
+}
+
+func sameCodec(a, b Codec) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b)
+}
+
+func addCodecMarker(codec Codec, payload []byte) ([]byte, error) {
+	codecsLock.RLock()
+	name, ok := codecNames[reflect.TypeOf(codec)]
+	codecsLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("codec %T is not registered, see RegisterCodec", codec)
+	}
+
+	bs := make([]byte, 0, 2+len(name)+len(payload))
+	bs = append(bs, codecMarker, byte(len(name)))
+	bs = append(bs, name...)
+	return append(bs, payload...), nil
+}
+
+// stripCodecMarker returns the codec and payload of a value starting
+// with codecMarker. The store's own codec is preferred over the
+// registered one of the same type, as it may carry settings.
+func (c *SSDBStore) stripCodecMarker(bs []byte) (Codec, []byte, error) {
+	if len(bs) < 2 || len(bs) < 2+int(bs[1]) {
+		return nil, nil, errors.New("malformed codec header")
+	}
+	name := string(bs[2 : 2+int(bs[1])])
+
+	codecsLock.RLock()
+	codec, ok := codecsByName[name]
+	codecsLock.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("value encoded with unknown codec %q", name)
+	}
+	if own := c.codec(); sameCodec(own, codec) {
+		codec = own
+	}
+	return codec, bs[2+int(bs[1]):], nil
+}
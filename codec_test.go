@@ -0,0 +1,146 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+type legacyPoint struct {
+	X, Y int
+}
+
+func init() {
+	gob.Register(legacyPoint{})
+}
+
+func TestSafeLegacyStructs(t *testing.T) {
+	// older versions encoded structs passed by value as they were
+	var value interface{} = legacyPoint{3, 4}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		t.Fatal(err)
+	}
+
+	store, b := newMemStore(t, Options{SafeLegacyStructs: true})
+	b.lock.Lock()
+	b.hashes["id"] = map[string]string{"p": buf.String()}
+	b.lock.Unlock()
+
+	v := store.Get("id", "p")
+	p, ok := v.(*legacyPoint)
+	if !ok {
+		t.Fatalf("got %T, want *legacyPoint", v)
+	}
+	expect(t, *p, legacyPoint{3, 4})
+
+	// the value is a copy which can be stored again the current way
+	p.X = 5
+	expect(t, store.Set("id", "p", p), nil)
+	expect(t, *store.Get("id", "p").(*legacyPoint), legacyPoint{5, 4})
+}
+
+func TestGobCodecStructValue(t *testing.T) {
+	store, _ := newMemStore(t, Options{})
+
+	var value interface{} = profile{"xlw", 1}
+	err := store.Set("id", "p", value)
+	expect(t, errors.Is(err, ErrStructValue), true)
+	expect(t, strings.Contains(err.Error(), "ssdbstore.profile"), true)
+
+	value = &profile{"xlw", 1}
+	expect(t, store.Set("id", "p", value), nil)
+	expect(t, *store.Get("id", "p").(*profile), profile{"xlw", 1})
+
+	var nilProfile *profile
+	refute(t, store.Set("id", "p", nilProfile), nil)
+}
+
+func TestCodecFor(t *testing.T) {
+	store, b := newMemStore(t, Options{
+		CodecFor: func(id session.Id) Codec {
+			if strings.HasPrefix(string(id), "svc-") {
+				return JSONCodec{}
+			}
+			return nil
+		},
+	})
+
+	expect(t, store.Set("svc-1", "n", 1), nil)
+	expect(t, store.Set("user", "n", 1), nil)
+	raw, _ := b.field("svc-1", "n")
+	expect(t, raw, "\x84\x04json1")
+	raw, _ = b.field("user", "n")
+	refute(t, raw[0], codecMarker)
+
+	expect(t, store.Get("svc-1", "n"), float64(1))
+	expect(t, store.Get("user", "n"), 1)
+
+	// values keep decoding with their codec when the selection changes
+	store.CodecFor = nil
+	expect(t, store.Get("svc-1", "n"), float64(1))
+	expect(t, store.Set("svc-1", "m", 2), nil)
+	expect(t, store.Get("svc-1", "m"), 2)
+}
+
+type unregisteredCodec struct{ JSONCodec }
+
+func TestCodecForUnregistered(t *testing.T) {
+	store, _ := newMemStore(t, Options{
+		CodecFor: func(session.Id) Codec { return unregisteredCodec{} },
+	})
+	err := store.Set("id", "n", 1)
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "RegisterCodec"), true)
+
+	refute(t, RegisterCodec("json", unregisteredCodec{}), nil)
+	refute(t, RegisterCodec("json2", JSONCodec{}), nil)
+}
+
+func TestJSONCodecOption(t *testing.T) {
+	store, b := newMemStore(t, Options{Codec: JSONCodec{}})
+
+	expect(t, store.Set("id", "user", &Test{1, "lunny"}), nil)
+	raw, _ := b.field("id", "user")
+	expect(t, raw, `{"Id":1,"Name":"lunny"}`)
+	user := store.Get("id", "user").(map[string]interface{})
+	expect(t, user["Name"], "lunny")
+	expect(t, user["Id"], float64(1))
+
+	// values written by other programs are read as well
+	b.lock.Lock()
+	b.hashes["id"]["flags"] = `["a","b"]`
+	b.lock.Unlock()
+	flags := store.Get("id", "flags").([]interface{})
+	expect(t, len(flags), 2)
+	expect(t, flags[1], "b")
+
+	// the store's codec needs no marker, gob values record theirs
+	store.CodecFor = func(session.Id) Codec { return GobCodec{} }
+	expect(t, store.Set("id", "n", 1), nil)
+	expect(t, store.Get("id", "n"), 1)
+
+	// transient fields are left out, BinaryMarshalers are JSON too
+	store.CodecFor = nil
+	expect(t, store.Set("id", "user", &transientUser{Name: "xlw", Token: "secret"}), nil)
+	raw, _ = b.field("id", "user")
+	expect(t, raw, `{"Name":"xlw","Token":""}`)
+	expect(t, store.Set("id", "value", transientUser{Name: "xlw", Token: "secret"}), nil)
+	raw, _ = b.field("id", "value")
+	expect(t, raw, `{"Name":"xlw","Token":""}`)
+
+	at := time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	expect(t, store.Set("id", "at", at), nil)
+	raw, _ = b.field("id", "at")
+	expect(t, raw, `"2015-01-01T00:00:00Z"`)
+	expect(t, store.Get("id", "at"), "2015-01-01T00:00:00Z")
+}
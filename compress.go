@@ -0,0 +1,63 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+
+	"github.com/tango-contrib/session"
+)
+
+// compressMarker starts a value whose payload is deflate compressed, see
+// binaryMarker for why the marker can not clash with gob data.
+const compressMarker byte = 0x83
+
+// compress deflates payload and returns it with compressMarker, or
+// payload unchanged when compressing does not make it smaller.
+func compress(payload []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(compressMarker)
+	w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+	w.Write(payload)
+	w.Close()
+	if buf.Len() >= len(payload) {
+		return payload
+	}
+	return buf.Bytes()
+}
+
+func decompress(bs []byte) ([]byte, error) {
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(bs[1:])))
+}
+
+// SetNoCompress sets a value like Set but never compresses it, whatever
+// Options.CompressThreshold says. It suits data which is compressed
+// already, reads detect either form.
+func (s *SSDBStore) SetNoCompress(id session.Id, key string, val interface{}) (err error) {
+	defer s.observe(&err)
+
+	if err = s.validateId(id); err != nil {
+		return err
+	}
+	s.cache.forget(id, key)
+	defer s.cache.forget(id, key)
+	s.stale.forget(id, key)
+
+	codec := s.codecFor(id)
+	bs, err := s.encode(codec, val, false, !sameCodec(codec, s.codec()))
+	if err != nil {
+		return err
+	}
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return s.write(c, id, key, bs)
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	store, b := newMemStore(t, Options{CompressThreshold: 64, Checksum: true})
+	large := strings.Repeat("session data ", 100)
+
+	expect(t, store.Set("id", "small", "tiny"), nil)
+	raw, _ := b.field("id", "small")
+	refute(t, raw[checksumHeader], compressMarker)
+
+	expect(t, store.Set("id", "large", large), nil)
+	raw, _ = b.field("id", "large")
+	expect(t, raw[checksumHeader], compressMarker)
+	expect(t, len(raw) < len(large), true)
+	expect(t, store.Get("id", "large"), large)
+}
+
+func TestSetNoCompress(t *testing.T) {
+	store, b := newMemStore(t, Options{CompressThreshold: 64})
+	large := strings.Repeat("session data ", 100)
+
+	expect(t, store.SetNoCompress("id", "large", large), nil)
+	raw, _ := b.field("id", "large")
+	refute(t, raw[0], compressMarker)
+	expect(t, len(raw) > len(large), true)
+	expect(t, store.Get("id", "large"), large)
+}
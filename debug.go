@@ -0,0 +1,46 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/hex"
+
+	"github.com/tango-contrib/session"
+)
+
+// DebugGet returns the bytes stored for a field exactly as SSDB returns
+// them, together with a hex dump, without decoding them or touching the
+// session expiry. It is meant for diagnosing encoding problems.
+func (s *SSDBStore) DebugGet(id session.Id, key string) (raw []byte, hexDump string, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return nil, "", err
+	}
+	defer c.Close()
+
+	v, err := c.Hget(s.key(id), key)
+	if err != nil {
+		return nil, "", err
+	}
+	raw = v.Bytes()
+	return raw, hex.Dump(raw), nil
+}
+
+// GetFromNode reads a value like Get and also returns the host:port of the
+// backend which served it, the primary or, after a promotion, the standby.
+func (s *SSDBStore) GetFromNode(id session.Id, key string) (value interface{}, node string, err error) {
+	defer s.observe(&err)
+
+	c, node, err := s.nodeConn()
+	if err != nil {
+		return nil, "", err
+	}
+	defer c.Close()
+
+	value, err = s.read(c, id, key)
+	return value, node, err
+}
@@ -0,0 +1,33 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDebugGet(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	b.lock.Lock()
+	b.hashes["id"] = map[string]string{"a": "\x80ABC\x00\xff"}
+	b.lock.Unlock()
+
+	raw, dump, err := store.DebugGet("id", "a")
+	expect(t, err, nil)
+	expect(t, bytes.Equal(raw, []byte{0x80, 'A', 'B', 'C', 0x00, 0xff}), true)
+	expect(t, dump, "00000000  80 41 42 43 00 ff                                 |.ABC..|\n")
+
+	raw, dump, err = store.DebugGet("id", "missing")
+	expect(t, err, nil)
+	expect(t, len(raw), 0)
+	expect(t, dump, "")
+
+	// counted like every other operation
+	b.setDown(true)
+	_, _, err = store.DebugGet("id", "a")
+	refute(t, err, nil)
+	expect(t, store.Stats().Errors, int64(1))
+}
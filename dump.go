@@ -0,0 +1,159 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ExportSSDBDump writes all sessions to w as SSDB protocol requests: an
+// hset for every field followed by an expire carrying the remaining TTL,
+// if any. Any SSDB server restores the dump when it is piped into its
+// port, for example with nc. Sessions are written one at a time as the
+// scan proceeds, so memory use does not grow with the store. Sessions
+// changing during the export are caught in whatever state they were read.
+func (s *SSDBStore) ExportSSDBDump(w io.Writer) (err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	bw := bufio.NewWriter(w)
+	var inner error
+	err = s.scan(c, func(ids []string) bool {
+		for _, id := range ids {
+			if inner = dumpSession(c, bw, id); inner != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = inner
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func dumpSession(c client, w *bufio.Writer, id string) error {
+	fields, err := c.HgetAll(id)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	ttl, err := c.Ttl(id)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err = writePacket(w, "hset", id, key, string(fields[key])); err != nil {
+			return err
+		}
+	}
+	if ttl > 0 {
+		return writePacket(w, "expire", id, strconv.FormatInt(ttl, 10))
+	}
+	return nil
+}
+
+// TTLMapper adjusts the lifetime of a session restored by
+// ImportSSDBDump. It gets the TTL the session had when it was dumped,
+// zero for sessions without expiry, and returns the TTL to give it,
+// where zero or less means no expiry.
+type TTLMapper func(original time.Duration) time.Duration
+
+// ImportSSDBDump restores sessions written by ExportSSDBDump, passing
+// each session's TTL through mapTTL first. A nil mapTTL keeps the TTLs
+// as they were dumped. Mapped TTLs are rounded up to whole seconds and
+// are subject to MinTTL. Keys are restored as dumped, so the dumping
+// store should use the same KeyPrefix. Fields are merged into sessions
+// which already exist.
+func (s *SSDBStore) ImportSSDBDump(r io.Reader, mapTTL TTLMapper) (err error) {
+	defer s.observe(&err)
+
+	if mapTTL == nil {
+		mapTTL = func(d time.Duration) time.Duration { return d }
+	}
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var (
+		cur string
+		ttl time.Duration
+	)
+	finish := func() error {
+		if cur == "" {
+			return nil
+		}
+		s.cache.forgetAll(s.id(cur))
+		s.stale.forgetAll(s.id(cur))
+		d := mapTTL(ttl)
+		if d <= 0 {
+			return nil
+		}
+		_, err := s.expire(c, s.id(cur), int64((d+time.Second-1)/time.Second))
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		req, err := readPacket(br)
+		if err == io.EOF {
+			return finish()
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(req) == 4 && req[0] == "hset":
+			if req[1] != cur {
+				if err = finish(); err != nil {
+					return err
+				}
+				cur, ttl = req[1], 0
+			}
+			if err = c.Hset(req[1], req[2], req[3]); err != nil {
+				return err
+			}
+		case len(req) == 3 && req[0] == "expire" && req[1] == cur:
+			secs, err := strconv.ParseInt(req[2], 10, 64)
+			if err != nil {
+				return fmt.Errorf("malformed expire of %q: %v", req[1], err)
+			}
+			ttl = time.Duration(secs) * time.Second
+		default:
+			return fmt.Errorf("unexpected request %q in dump", req)
+		}
+	}
+}
+
+// writePacket writes a request in the SSDB protocol, see roundTrip.
+func writePacket(w io.Writer, args ...string) error {
+	for _, arg := range args {
+		if _, err := io.WriteString(w, strconv.Itoa(len(arg))+"\n"+arg+"\n"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
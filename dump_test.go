@@ -0,0 +1,74 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportSSDBDump(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute, ScanBatchSize: 1})
+	expect(t, store.Set("a", "x", "1"), nil)
+	expect(t, store.Set("a", "y", "line\nbreak"), nil)
+	addWithoutTTL(b, "b")
+
+	var buf bytes.Buffer
+	expect(t, store.ExportSSDBDump(&buf), nil)
+	refute(t, buf.Len(), 0)
+
+	var cmds []string
+	r := bufio.NewReader(&buf)
+	for {
+		req, err := readPacket(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, req[0]+" "+req[1])
+		if req[0] == "hset" && req[2] == "y" {
+			raw, _ := b.field("a", "y")
+			expect(t, req[3], raw)
+		}
+	}
+	expect(t, strings.Join(cmds, ","), "hset a,hset a,expire a,hset b")
+}
+
+func TestImportSSDBDump(t *testing.T) {
+	from, _ := newMemStore(t, Options{MaxAge: time.Minute})
+	expect(t, from.Set("a", "x", "1"), nil)
+	expect(t, from.Set("a", "y", "2"), nil)
+	expect(t, from.SetWithMaxAge("b", "x", "3", time.Hour), nil)
+
+	var dump bytes.Buffer
+	expect(t, from.ExportSSDBDump(&dump), nil)
+	raw := dump.String()
+
+	to, b := newMemStore(t, Options{})
+	expect(t, to.ImportSSDBDump(strings.NewReader(raw), nil), nil)
+	expect(t, b.ttl("a"), int64(60))
+	expect(t, b.ttl("b"), int64(3600))
+	expect(t, to.Get("a", "y"), "2")
+
+	// halve, and never beyond ten minutes
+	to, b = newMemStore(t, Options{})
+	expect(t, to.ImportSSDBDump(strings.NewReader(raw), func(d time.Duration) time.Duration {
+		if d /= 2; d > 10*time.Minute {
+			d = 10 * time.Minute
+		}
+		return d
+	}), nil)
+	expect(t, b.ttl("a"), int64(30))
+	expect(t, b.ttl("b"), int64(600))
+	expect(t, to.Get("b", "x"), "3")
+
+	refute(t, to.ImportSSDBDump(strings.NewReader("3\ndel\n1\na\n\n"), nil), nil)
+}
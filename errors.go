@@ -0,0 +1,114 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrClosed is returned by operations on a closed store.
+	ErrClosed = errors.New("store is closed")
+
+	// ErrAsyncQueueFull is returned by SetAsync while all queued writes
+	// are pending.
+	ErrAsyncQueueFull = errors.New("async write queue is full")
+
+	// ErrSerializeTimeout is returned when encoding a value took longer
+	// than Options.SerializeTimeout.
+	ErrSerializeTimeout = errors.New("serialize timed out")
+)
+
+// ErrWeakId is returned for session ids rejected by Options.IdValidator.
+var ErrWeakId = errors.New("weak session id")
+
+// ErrChecksumMismatch is returned when a stored value does not match the
+// checksum recorded with it.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrStructValue is returned for structs passed to Set by value. The gob
+// codec only round trips structs through pointers, which is what Get
+// returns for them.
+var ErrStructValue = errors.New("struct values can not be stored, pass a pointer")
+
+// ErrNotCleared is returned when Options.VerifyClear found a session
+// still existing after deleting it twice.
+var ErrNotCleared = errors.New("session still exists after clear")
+
+// ErrExpireUnsupported is returned by New when Options.CheckExpire found
+// the server unable to expire hashes.
+var ErrExpireUnsupported = errors.New("ssdb server does not support EXPIRE on hashes, set EmulateExpire to emulate it")
+
+// The kinds of backend errors, match them with errors.Is. Every error the
+// SSDB client returns is reported as a BackendError of one of these kinds.
+var (
+	ErrConnectionClosed = errors.New("ssdb connection closed")
+	ErrNotFound         = errors.New("ssdb key not found")
+	ErrAuthRequired     = errors.New("ssdb authentication required")
+	ErrTimeout          = errors.New("ssdb command timed out")
+	ErrUnknown          = errors.New("unclassified ssdb error")
+)
+
+// BackendError is an error of the SSDB client classified by Kind, one of
+// ErrConnectionClosed, ErrNotFound, ErrAuthRequired, ErrTimeout or
+// ErrUnknown. Its message is the client's own.
+type BackendError struct {
+	Kind error
+	Err  error
+}
+
+func (e *BackendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BackendError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// ErrNoKeyPrefix is returned by RepairMissingTTL, and by New for
+// Options.TTLRepairInterval, without a KeyPrefix. The repair would visit
+// every hash on the server and give persistent hashes of other
+// applications an expiry.
+var ErrNoKeyPrefix = errors.New("TTL repair needs a KeyPrefix")
+
+// ErrValueTooLarge matches, via errors.Is, values the SSDB server refused
+// to store because of their size.
+var ErrValueTooLarge = errors.New("value too large")
+
+// ValueTooLargeError reports a field the SSDB server refused because of
+// the size of its serialized value.
+type ValueTooLargeError struct {
+	Field string
+	Size  int
+	Err   error
+}
+
+func (e *ValueTooLargeError) Error() string {
+	return fmt.Sprintf("ssdb refused field %s of %d bytes as too large: %v", e.Field, e.Size, e.Err)
+}
+
+func (e *ValueTooLargeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValueTooLargeError) Is(target error) bool {
+	return target == ErrValueTooLarge
+}
+
+// valueTooLarge wraps err as a ValueTooLargeError when it is the server's
+// size limit error and returns it unchanged otherwise.
+func valueTooLarge(err error, field string, size int) error {
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "too large") || strings.Contains(msg, "too long") {
+		return &ValueTooLargeError{Field: field, Size: size, Err: err}
+	}
+	return err
+}
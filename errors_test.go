@@ -0,0 +1,68 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValueTooLarge(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	b.failWith("hset", errors.New("access ssdb error, code is [client_error value too large]"))
+
+	err := store.Set("id", "big", "value")
+	expect(t, errors.Is(err, ErrValueTooLarge), true)
+
+	var tooLarge *ValueTooLargeError
+	expect(t, errors.As(err, &tooLarge), true)
+	expect(t, tooLarge.Field, "big")
+	bs, _ := store.serialize("value")
+	expect(t, tooLarge.Size, len(bs))
+
+	b.failWith("hset", errBackendDown)
+	err = store.Set("id", "big", "value")
+	expect(t, errors.Is(err, errBackendDown), true)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o deadline reached" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		kind error
+	}{
+		{errors.New("client read error: use of closed network connection"), ErrConnectionClosed},
+		{errors.New("write tcp 127.0.0.1:8888: broken pipe"), ErrConnectionClosed},
+		{errors.New("EOF"), ErrConnectionClosed},
+		{errors.New("access ssdb error, code is [not_found]"), ErrNotFound},
+		{errors.New("access ssdb error, code is [noauth authentication required]"), ErrAuthRequired},
+		{errors.New("get client timeout"), ErrTimeout},
+		{timeoutError{}, ErrTimeout},
+		{errors.New("access ssdb error, code is [error]"), ErrUnknown},
+	} {
+		err := classify(c.err)
+		expect(t, errors.Is(err, c.kind), true)
+		expect(t, errors.Is(err, c.err), true)
+		expect(t, err.Error(), c.err.Error())
+	}
+	expect(t, classify(nil), nil)
+
+	store, b := newMemStore(t, Options{})
+	b.failWith("hset", errors.New("read tcp 127.0.0.1:8888: i/o timeout"))
+	err := store.Set("id", "a", "1")
+	expect(t, errors.Is(err, ErrTimeout), true)
+	var be *BackendError
+	expect(t, errors.As(err, &be), true)
+	expect(t, classify(err), err)
+
+	b.failWith("hset", nil)
+	b.setDown(true)
+	expect(t, errors.Is(store.Set("id", "a", "1"), ErrUnknown), true)
+}
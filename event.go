@@ -0,0 +1,39 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+// Event types published to Options.EventQueue.
+const (
+	EventAdd   = "add"
+	EventClear = "clear"
+)
+
+// Event is the JSON payload pushed to Options.EventQueue.
+type Event struct {
+	Id   session.Id `json:"id"`
+	Type string     `json:"event"`
+	Time time.Time  `json:"time"`
+}
+
+// publish pushes an event about id to the event queue, if configured.
+func (s *SSDBStore) publish(c client, id session.Id, typ string) {
+	if s.EventQueue == "" {
+		return
+	}
+	bs, err := json.Marshal(Event{Id: id, Type: typ, Time: s.clock.Now()})
+	if err == nil {
+		_, err = c.Qpush(s.EventQueue, bs)
+	}
+	if err != nil {
+		s.logger().Errorf("ssdb QPUSH %s failed: %s", s.EventQueue, err)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestEventQueue(t *testing.T) {
+	store, b := newMemStore(t, Options{EventQueue: "events"})
+	clock := newFakeClock()
+	store.clock = clock
+
+	expect(t, store.Add("id"), true)
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Clear("id"), true)
+
+	b.lock.Lock()
+	msgs := b.queues["events"]
+	b.lock.Unlock()
+	expect(t, len(msgs), 2)
+
+	var ev Event
+	expect(t, json.Unmarshal([]byte(msgs[0]), &ev), nil)
+	expect(t, ev.Id, session.Id("id"))
+	expect(t, ev.Type, EventAdd)
+	expect(t, ev.Time.Equal(clock.Now()), true)
+
+	expect(t, json.Unmarshal([]byte(msgs[1]), &ev), nil)
+	expect(t, ev.Type, EventClear)
+
+	// publish failures do not fail the operation
+	b.failWith("qpush", errors.New("queue full"))
+	expect(t, store.Add("id"), true)
+}
+
+func TestEventQueueDisabled(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+
+	expect(t, store.Add("id"), true)
+	expect(t, store.Clear("id"), true)
+	expect(t, b.count("qpush"), 0)
+}
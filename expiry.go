@@ -0,0 +1,165 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+const (
+	// expiresField holds the unix time a session expires at while the
+	// expiry is emulated.
+	expiresField = reservedPrefix + "expires"
+
+	// probeKey starts the ids of the hashes New writes to find out whether
+	// the server can expire hashes, followed by a random suffix so that
+	// processes starting together do not delete each other's probe.
+	probeKey = reservedPrefix + "expire-probe:"
+
+	// probeAttempts bounds how often the probe is written again when it
+	// vanished before its EXPIRE.
+	probeAttempts = 3
+)
+
+// probeExpire reports whether the server sets expiries on hashes. Only a
+// refused EXPIRE means it does not, every other error, like a timeout or
+// a reset connection, is returned so a transient failure does not turn
+// emulation on for the lifetime of the store. An EXPIRE reporting no
+// expiry set only counts when the probe still exists, otherwise it is
+// written again.
+func (s *SSDBStore) probeExpire() (bool, error) {
+	c, err := s.conn()
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	var suffix [8]byte
+	if _, err = rand.Read(suffix[:]); err != nil {
+		return false, err
+	}
+	key := s.key(session.Id(probeKey + hex.EncodeToString(suffix[:])))
+	defer c.Del(key)
+
+	for i := 0; i < probeAttempts; i++ {
+		if err = c.Hset(key, "probe", "1"); err != nil {
+			return false, err
+		}
+		ok, err := c.Expire(key, 60)
+		if err != nil {
+			if unknownCommand(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+		exists, err := c.Exists(key)
+		if err != nil {
+			return false, err
+		}
+		if exists {
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("probe %q vanished %d times before its EXPIRE", key, probeAttempts)
+}
+
+// unknownCommand reports whether the server refused a command it does
+// not implement.
+func unknownCommand(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "client_error") || strings.Contains(msg, "unknown command")
+}
+
+// checkExpire runs the probe requested by the options.
+func (s *SSDBStore) checkExpire() error {
+	supported, err := s.probeExpire()
+	if err != nil {
+		return fmt.Errorf("probing EXPIRE: %w", err)
+	}
+	if supported {
+		return nil
+	}
+	if !s.EmulateExpire {
+		return ErrExpireUnsupported
+	}
+	s.logger().Warnf("ssdb server does not expire hashes, session expiry is emulated")
+	s.emulatedExpiry = true
+	return nil
+}
+
+// expire sets the lifetime of a session to seconds, but no less than
+// MinTTL, on servers without EXPIRE by recording when it ends. Every
+// expiry the store sets goes through it. Raising a TTL is logged once
+// per value, as one derived from MaxAge is raised on every request;
+// callers with their own maxAge log through atLeastMinTTL instead.
+func (s *SSDBStore) expire(c client, id session.Id, seconds int64) (bool, error) {
+	if floor := int64(s.MinTTL / time.Second); seconds < floor {
+		if atomic.SwapInt64(&s.minTTLWarned, seconds+1) != seconds+1 {
+			s.logger().Warnf("ssdb session %s: TTL of %ds raised to MinTTL %v", id, seconds, s.MinTTL)
+		}
+		seconds = floor
+	}
+	if !s.emulatedExpiry {
+		return c.Expire(s.key(id), seconds)
+	}
+	at := s.clock.Now().Unix() + seconds
+	return true, c.Hset(s.key(id), expiresField, strconv.FormatInt(at, 10))
+}
+
+// atLeastMinTTL raises the seconds of a maxAge passed for one call to
+// MinTTL, logging each time.
+func (s *SSDBStore) atLeastMinTTL(id session.Id, seconds int64) int64 {
+	if floor := int64(s.MinTTL / time.Second); seconds < floor {
+		s.logger().Warnf("ssdb session %s: TTL of %ds raised to MinTTL %v", id, seconds, s.MinTTL)
+		return floor
+	}
+	return seconds
+}
+
+// expired reports whether an emulated expiry has passed, removing the
+// session if so.
+func (s *SSDBStore) expired(c client, id session.Id) (bool, error) {
+	if !s.emulatedExpiry {
+		return false, nil
+	}
+	v, err := c.Hget(s.key(id), expiresField)
+	if err != nil || v.IsEmpty() {
+		return false, err
+	}
+	at, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil || s.clock.Now().Unix() < at {
+		return false, nil
+	}
+	return true, c.Del(s.key(id))
+}
+
+// WithoutSliding runs fn with expiry sliding turned off, so bulk reads
+// during maintenance, such as walking every session, leave the TTLs of
+// the sessions they touch alone. The mode is store wide and also covers
+// requests served meanwhile. Writes keep setting the expiry, as new
+// sessions would otherwise never expire. Sliding resumes when fn
+// returns, fails or panics; overlapping calls resume it once the last
+// of them is done.
+func (s *SSDBStore) WithoutSliding(fn func() error) error {
+	atomic.AddInt32(&s.noSliding, 1)
+	defer atomic.AddInt32(&s.noSliding, -1)
+	return fn()
+}
+
+// sliding reports whether reads should refresh the session expiry.
+func (s *SSDBStore) sliding() bool {
+	return atomic.LoadInt32(&s.noSliding) == 0
+}
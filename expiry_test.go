@@ -0,0 +1,169 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+var errUnknownCommand = errors.New("client_error: unknown command")
+
+// probes returns the keys of the EXPIRE probes left on b.
+func probes(b *memBackend, prefix string) []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var keys []string
+	for key := range b.hashes {
+		if strings.HasPrefix(key, prefix+probeKey) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestCheckExpire(t *testing.T) {
+	store, b := newMemStore(t, Options{CheckExpire: true})
+	expect(t, store.emulatedExpiry, false)
+	expect(t, b.count("expire"), 1)
+	expect(t, len(probes(b, "")), 0)
+
+	// the probe stays under the KeyPrefix like every other key, and each
+	// probe has a key of its own
+	store, b = newMemStore(t, Options{KeyPrefix: "p:"})
+	b.failWith("del", errBackendDown)
+	expect(t, store.checkExpire(), nil)
+	expect(t, store.checkExpire(), nil)
+	expect(t, len(probes(b, "p:")), 2)
+
+	b = newMemBackend()
+	b.failWith("expire", errUnknownCommand)
+	usePools(t, map[string]*memBackend{"old": b})
+	_, err := New(Options{Host: "old", CheckExpire: true})
+	expect(t, err, ErrExpireUnsupported)
+
+	b.setDown(true)
+	_, err = New(Options{Host: "old", CheckExpire: true})
+	expect(t, errors.Is(err, errBackendDown), true)
+
+	// a failing EXPIRE is not taken for a missing one
+	b.setDown(false)
+	b.failWith("expire", errors.New("read tcp 127.0.0.1:8888: i/o timeout"))
+	_, err = New(Options{Host: "old", CheckExpire: true})
+	expect(t, errors.Is(err, ErrTimeout), true)
+	_, err = New(Options{Host: "old", EmulateExpire: true})
+	expect(t, errors.Is(err, ErrTimeout), true)
+}
+
+func TestProbeVanished(t *testing.T) {
+	b := newMemBackend()
+	usePools(t, map[string]*memBackend{"mem": b})
+	gate := b.block("expire")
+
+	done := make(chan error)
+	go func() {
+		_, err := New(Options{Host: "mem", CheckExpire: true})
+		done <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for b.count("expire") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("probe did not EXPIRE")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// another process removes the probe between its HSET and EXPIRE
+	b.lock.Lock()
+	for key := range b.hashes {
+		delete(b.hashes, key)
+	}
+	b.lock.Unlock()
+	close(gate)
+
+	expect(t, <-done, nil)
+	expect(t, b.count("expire"), 2)
+}
+
+func TestEmulateExpire(t *testing.T) {
+	b := newMemBackend()
+	b.failWith("expire", errUnknownCommand)
+	usePools(t, map[string]*memBackend{"old": b})
+	store, err := New(Options{Host: "old", EmulateExpire: true, MaxAge: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, store.emulatedExpiry, true)
+	clock := newFakeClock()
+	store.clock = clock
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	at, _ := b.field("id", expiresField)
+	expect(t, at, "1420070460")
+
+	// reads slide the emulated expiry like they slide a real one
+	clock.Advance(50 * time.Second)
+	expect(t, store.Get("id", "a"), "1")
+	clock.Advance(50 * time.Second)
+	expect(t, store.Get("id", "a"), "1")
+	keys, err := store.Keys("id")
+	expect(t, err, nil)
+	expect(t, len(keys), 1)
+
+	clock.Advance(time.Minute)
+	expect(t, store.Get("id", "a"), nil)
+	expect(t, store.Exist("id"), false)
+
+	// every read honours the emulated expiry, not only Get
+	for _, id := range []session.Id{"exist", "peek", "keys", "getall"} {
+		expect(t, store.Set(id, "a", "1"), nil)
+	}
+	expect(t, store.Exist("exist"), true)
+	clock.Advance(2 * time.Minute)
+	expect(t, store.Exist("exist"), false)
+	_, found, err := store.Peek("peek", "a")
+	expect(t, err, nil)
+	expect(t, found, false)
+	keys, err = store.Keys("keys")
+	expect(t, err, nil)
+	expect(t, len(keys), 0)
+	values, err := store.GetAll("getall")
+	expect(t, err, nil)
+	expect(t, len(values), 0)
+	for _, id := range []string{"exist", "peek", "keys", "getall"} {
+		_, ok := b.field(id, "a")
+		expect(t, ok, false)
+	}
+}
+
+func TestWithoutSliding(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute})
+	for _, id := range []session.Id{"a", "b"} {
+		expect(t, store.Set(id, "k", "1"), nil)
+	}
+	b.lock.Lock()
+	b.ttls["a"], b.ttls["b"] = 10, 20
+	b.lock.Unlock()
+
+	errDone := errors.New("done")
+	err := store.WithoutSliding(func() error {
+		store.Iterate(func(id session.Id) bool {
+			expect(t, store.Get(id, "k"), "1")
+			return true
+		})
+		return errDone
+	})
+	expect(t, err, errDone)
+	expect(t, b.ttl("a"), int64(10))
+	expect(t, b.ttl("b"), int64(20))
+
+	// restored once the maintenance is over
+	expect(t, store.Get("a", "k"), "1")
+	expect(t, b.ttl("a"), int64(60))
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/tango-contrib/session"
+)
+
+// fieldNameBounds are the upper bounds of the field name length buckets,
+// a last bucket counts longer names.
+var fieldNameBounds = [...]int{8, 16, 32, 64, 128, 256}
+
+type fieldNameStats struct {
+	counts [len(fieldNameBounds) + 1]uint64
+}
+
+// FieldNameBucket counts written field names of at most Max bytes and
+// longer than the previous bucket's Max. Max is 0 for the last bucket,
+// which holds all names longer than 256 bytes.
+type FieldNameBucket struct {
+	Max   int
+	Count uint64
+}
+
+// track counts the name of a written field and warns about long ones.
+func (f *fieldNameStats) track(s *SSDBStore, id session.Id, key string) {
+	if strings.HasPrefix(key, reservedPrefix) {
+		return
+	}
+	i := 0
+	for i < len(fieldNameBounds) && len(key) > fieldNameBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&f.counts[i], 1)
+
+	if s.FieldNameWarnLength > 0 && len(key) > s.FieldNameWarnLength {
+		prefix := key
+		if len(prefix) > 32 {
+			prefix = prefix[:32] + "..."
+		}
+		s.logger().Warnf("ssdb session %s: field name of %d bytes exceeds %d: %q",
+			id, len(key), s.FieldNameWarnLength, prefix)
+	}
+}
+
+// FieldNameLengths returns the distribution of the lengths of the field
+// names written so far.
+func (s *SSDBStore) FieldNameLengths() []FieldNameBucket {
+	buckets := make([]FieldNameBucket, len(s.fieldNames.counts))
+	for i := range buckets {
+		if i < len(fieldNameBounds) {
+			buckets[i].Max = fieldNameBounds[i]
+		}
+		buckets[i].Count = atomic.LoadUint64(&s.fieldNames.counts[i])
+	}
+	return buckets
+}
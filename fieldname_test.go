@@ -0,0 +1,32 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFieldNameWarning(t *testing.T) {
+	store, _ := newMemStore(t, Options{FieldNameWarnLength: 64})
+	logger := newMemLogger()
+	store.Logger = logger
+
+	expect(t, store.Add("id"), true)
+	expect(t, store.Set("id", "user", "1"), nil)
+	expect(t, store.Set("id", strings.Repeat("k", 64), "1"), nil)
+	expect(t, len(logger.get("warn")), 0)
+
+	expect(t, store.Set("id", strings.Repeat("k", 300), "1"), nil)
+	warns := logger.get("warn")
+	expect(t, len(warns), 1)
+	expect(t, strings.Contains(warns[0], "300 bytes"), true)
+
+	buckets := store.FieldNameLengths()
+	expect(t, len(buckets), 7)
+	expect(t, buckets[0], FieldNameBucket{Max: 8, Count: 1})
+	expect(t, buckets[3], FieldNameBucket{Max: 64, Count: 1})
+	expect(t, buckets[6], FieldNameBucket{Max: 0, Count: 1})
+}
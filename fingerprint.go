@@ -0,0 +1,112 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+
+	"github.com/tango-contrib/session"
+)
+
+// fingerprintMarker starts a value made of the big endian fingerprint of
+// the stored type followed by the payload, see binaryMarker for why the
+// marker can not clash with gob data.
+const fingerprintMarker byte = 0x85
+
+const fingerprintHeader = 1 + 8
+
+// typeFingerprint hashes the structure of t: kinds, element types and the
+// names, tags and types of struct fields. Changing a field of a stored
+// struct between deploys changes the fingerprint.
+func typeFingerprint(t reflect.Type) uint64 {
+	h := fnv.New64a()
+	describeType(h, t, make(map[reflect.Type]bool))
+	return h.Sum64()
+}
+
+func describeType(w io.Writer, t reflect.Type, seen map[reflect.Type]bool) {
+	if t.Name() != "" {
+		fmt.Fprintf(w, "%s.%s:", t.PkgPath(), t.Name())
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		io.WriteString(w, "*")
+		describeType(w, t.Elem(), seen)
+	case reflect.Slice:
+		io.WriteString(w, "[]")
+		describeType(w, t.Elem(), seen)
+	case reflect.Array:
+		fmt.Fprintf(w, "[%d]", t.Len())
+		describeType(w, t.Elem(), seen)
+	case reflect.Map:
+		io.WriteString(w, "map[")
+		describeType(w, t.Key(), seen)
+		io.WriteString(w, "]")
+		describeType(w, t.Elem(), seen)
+	case reflect.Struct:
+		io.WriteString(w, "struct{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(w, "%s %q ", f.Name, f.Tag)
+			describeType(w, f.Type, seen)
+			io.WriteString(w, ";")
+		}
+		io.WriteString(w, "}")
+	default:
+		io.WriteString(w, t.Kind().String())
+	}
+}
+
+func addFingerprint(payload []byte, value interface{}) []byte {
+	if value == nil {
+		return payload
+	}
+	bs := make([]byte, fingerprintHeader+len(payload))
+	bs[0] = fingerprintMarker
+	binary.BigEndian.PutUint64(bs[1:], typeFingerprint(reflect.TypeOf(value)))
+	copy(bs[fingerprintHeader:], payload)
+	return bs
+}
+
+func stripFingerprint(bs []byte) ([]byte, error) {
+	if len(bs) < fingerprintHeader {
+		return nil, errors.New("malformed fingerprint header")
+	}
+	return bs[fingerprintHeader:], nil
+}
+
+// storedFingerprint returns the fingerprint of a stored value, if it has
+// one.
+func storedFingerprint(bs []byte) (uint64, bool) {
+	for len(bs) >= checksumHeader && bs[0] == checksumMarker {
+		bs = bs[checksumHeader:]
+	}
+	if len(bs) < fingerprintHeader || bs[0] != fingerprintMarker {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(bs[1:]), true
+}
+
+// checkFingerprint reports a value which was stored with a different
+// structure of its type than the one it decoded into.
+func (s *SSDBStore) checkFingerprint(id session.Id, key string, raw []byte, value interface{}) {
+	if s.OnFingerprintMismatch == nil || value == nil {
+		return
+	}
+	stored, ok := storedFingerprint(raw)
+	if !ok || stored == typeFingerprint(reflect.TypeOf(value)) {
+		return
+	}
+	s.OnFingerprintMismatch(id, key, value)
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/tango-contrib/session"
+)
+
+// profileV1 is how profile looked before a field changed its type.
+type profileV1 struct {
+	Name  string
+	Level int
+}
+
+type profile struct {
+	Name  string
+	Level float64
+}
+
+func TestTypeFingerprint(t *testing.T) {
+	expect(t, typeFingerprint(reflect.TypeOf(&profile{})), typeFingerprint(reflect.TypeOf(&profile{})))
+	refute(t, typeFingerprint(reflect.TypeOf(profile{})), typeFingerprint(reflect.TypeOf(&profile{})))
+	refute(t, typeFingerprint(reflect.TypeOf(profileV1{})), typeFingerprint(reflect.TypeOf(profile{})))
+}
+
+func TestFingerprintMismatch(t *testing.T) {
+	var mismatches []string
+	store, b := newMemStore(t, Options{
+		Fingerprint: true,
+		Checksum:    true,
+		OnFingerprintMismatch: func(id session.Id, key string, value interface{}) {
+			mismatches = append(mismatches, string(id)+":"+key)
+		},
+	})
+
+	expect(t, store.Set("id", "p", &profile{"xlw", 3}), nil)
+	expect(t, store.Get("id", "p").(*profile).Level, float64(3))
+	expect(t, len(mismatches), 0)
+
+	// pretend the value was written by a binary with the old definition
+	raw, _ := b.field("id", "p")
+	old := []byte(raw[checksumHeader:])
+	binary.BigEndian.PutUint64(old[1:], typeFingerprint(reflect.TypeOf(&profileV1{})))
+	b.lock.Lock()
+	b.hashes["id"]["p"] = string(addChecksum(old))
+	b.lock.Unlock()
+
+	expect(t, store.Get("id", "p").(*profile).Name, "xlw")
+	expect(t, len(mismatches), 1)
+	expect(t, mismatches[0], "id:p")
+
+	// values without a fingerprint are never reported
+	store.Fingerprint = false
+	expect(t, store.Set("id", "q", &profile{"lunny", 1}), nil)
+	store.Get("id", "q")
+	expect(t, len(mismatches), 1)
+}
@@ -0,0 +1,45 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import "sync"
+
+// flight is a call in progress or completed within a flightGroup.
+type flight struct {
+	wg   sync.WaitGroup
+	val  interface{}
+	dups int
+}
+
+// flightGroup merges concurrent calls for the same key into one.
+type flightGroup struct {
+	lock  sync.Mutex
+	calls map[string]*flight
+}
+
+// do runs fn once for all concurrent callers of key and hands each of
+// them its result.
+func (g *flightGroup) do(key string, fn func() interface{}) interface{} {
+	g.lock.Lock()
+	if f, ok := g.calls[key]; ok {
+		f.dups++
+		g.lock.Unlock()
+		f.wg.Wait()
+		return f.val
+	}
+	f := new(flight)
+	f.wg.Add(1)
+	g.calls[key] = f
+	g.lock.Unlock()
+
+	defer func() {
+		g.lock.Lock()
+		delete(g.calls, key)
+		g.lock.Unlock()
+		f.wg.Done()
+	}()
+	f.val = fn()
+	return f.val
+}
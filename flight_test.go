@@ -0,0 +1,54 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDedupeGets(t *testing.T) {
+	store, b := newMemStore(t, Options{DedupeGets: true})
+	expect(t, store.Set("id", "a", "1"), nil)
+
+	gate := b.block("hget")
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = store.Get("id", "a")
+		}(i)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for store.flights.waiting("id\x00a") < n-1 {
+		if time.Now().After(deadline) {
+			t.Fatal("gets did not join the pending call")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(gate)
+	wg.Wait()
+
+	expect(t, b.count("hget"), 1)
+	for _, res := range results {
+		expect(t, res, "1")
+	}
+}
+
+// waiting returns how many callers joined the call in progress for key.
+func (g *flightGroup) waiting(key string) int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if f, ok := g.calls[key]; ok {
+		return f.dups
+	}
+	return 0
+}
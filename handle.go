@@ -0,0 +1,132 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"context"
+
+	"github.com/tango-contrib/session"
+)
+
+// ClientHandle runs the store's commands on a single pooled connection.
+// Every command first checks the context the handle was acquired with
+// and fails with its error once it is done. A handle is not safe for
+// concurrent use and must be released with Release.
+type ClientHandle interface {
+	Set(id session.Id, key string, val interface{}) error
+	Get(id session.Id, key string) (interface{}, error)
+	Del(id session.Id, key string) error
+	Exist(id session.Id) (bool, error)
+	Clear(id session.Id) error
+	Release()
+}
+
+type clientHandle struct {
+	s   *SSDBStore
+	ctx context.Context
+	c   client
+}
+
+// AcquireContext takes a connection from the pool for a sequence of
+// related commands. Waiting for the connection is abandoned when ctx is
+// done.
+func (s *SSDBStore) AcquireContext(ctx context.Context) (ClientHandle, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		c   client
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		c, err := s.conn()
+		done <- result{c, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return nil, r.err
+		}
+		return &clientHandle{s: s, ctx: ctx, c: r.c}, nil
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.err == nil {
+				r.c.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (h *clientHandle) Set(id session.Id, key string, val interface{}) (err error) {
+	defer h.s.observe(&err)
+	if err = h.ctx.Err(); err != nil {
+		return err
+	}
+	if err = h.s.validateId(id); err != nil {
+		return err
+	}
+	h.s.cache.forget(id, key)
+	defer h.s.cache.forget(id, key)
+	h.s.stale.forget(id, key)
+
+	bs, err := h.s.serializeFor(id, val)
+	if err != nil {
+		return err
+	}
+	return h.s.write(h.c, id, key, bs)
+}
+
+func (h *clientHandle) Get(id session.Id, key string) (value interface{}, err error) {
+	defer h.s.observe(&err)
+	if err = h.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return h.s.read(h.c, id, key)
+}
+
+func (h *clientHandle) Del(id session.Id, key string) (err error) {
+	defer h.s.observe(&err)
+	if err = h.ctx.Err(); err != nil {
+		return err
+	}
+	h.s.cache.forget(id, key)
+	defer h.s.cache.forget(id, key)
+	h.s.stale.forget(id, key)
+	return h.c.Hdel(h.s.key(id), key)
+}
+
+func (h *clientHandle) Exist(id session.Id) (has bool, err error) {
+	defer h.s.observe(&err)
+	if err = h.ctx.Err(); err != nil {
+		return false, err
+	}
+	return h.c.Exists(h.s.key(id))
+}
+
+func (h *clientHandle) Clear(id session.Id) (err error) {
+	defer h.s.observe(&err)
+	if err = h.ctx.Err(); err != nil {
+		return err
+	}
+	h.s.cache.forgetAll(id)
+	defer h.s.cache.forgetAll(id)
+	h.s.stale.forgetAll(id)
+	if err = h.c.Del(h.s.key(id)); err != nil {
+		return err
+	}
+	h.s.publish(h.c, id, EventClear)
+	return nil
+}
+
+func (h *clientHandle) Release() {
+	if h.c != nil {
+		h.c.Close()
+		h.c = nil
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAcquireContext(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+
+	h, err := store.AcquireContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, h.Set("id", "a", "1"), nil)
+	expect(t, h.Set("id", "b", "2"), nil)
+	v, err := h.Get("id", "a")
+	expect(t, err, nil)
+	expect(t, v, "1")
+	expect(t, h.Del("id", "a"), nil)
+	has, err := h.Exist("id")
+	expect(t, err, nil)
+	expect(t, has, true)
+	expect(t, h.Clear("id"), nil)
+	has, err = h.Exist("id")
+	expect(t, err, nil)
+	expect(t, has, false)
+
+	expect(t, store.Stats().InFlight, int64(1))
+	h.Release()
+	expect(t, store.Stats().InFlight, int64(0))
+	expect(t, b.count("connect"), 1)
+}
+
+func TestAcquireContextCanceled(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h, err := store.AcquireContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Release()
+	cancel()
+	expect(t, h.Set("id", "a", "1"), context.Canceled)
+	expect(t, b.count("hset"), 0)
+
+	_, err = store.AcquireContext(ctx)
+	expect(t, err, context.Canceled)
+}
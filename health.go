@@ -0,0 +1,54 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// healthWindow is how far back HealthScore looks at errors.
+	healthWindow = time.Minute
+
+	// Latencies up to fastLatency earn all latency points, from
+	// slowLatency on none.
+	fastLatency = 10 * time.Millisecond
+	slowLatency = 500 * time.Millisecond
+)
+
+// HealthScore rates the store from 0, unusable, to 100, healthy, from
+// the metrics it tracks anyway, without contacting the backend:
+//
+//   - 50 points for the share of operations of the last minute which
+//     succeeded, all of them without operations,
+//   - 30 points for the average time a client is held, all of them up to
+//     10ms, decreasing linearly to none at 500ms,
+//   - 20 points for the share of the connection pool which is idle, all
+//     of them without a MaxPoolSize to saturate.
+//
+// It is meant to shift traffic gradually, not as a binary check, see
+// Ping for that.
+func (s *SSDBStore) HealthScore() int {
+	errorRate := s.outcomes.rate(s.clock.Now().Add(-healthWindow))
+
+	var latency float64
+	switch avg := s.latency.get(); {
+	case avg <= fastLatency:
+		latency = 1
+	case avg < slowLatency:
+		latency = float64(slowLatency-avg) / float64(slowLatency-fastLatency)
+	}
+
+	idle := 1.0
+	if s.MaxPoolSize > 0 {
+		idle -= float64(atomic.LoadInt64(&s.stats.InFlight)) / float64(s.MaxPoolSize)
+		if idle < 0 {
+			idle = 0
+		}
+	}
+
+	return int(50*(1-errorRate) + 30*latency + 20*idle + 0.5)
+}
@@ -0,0 +1,139 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+// SessionInfo describes a stored session as seen by InspectMulti.
+type SessionInfo struct {
+	Id         session.Id
+	Exists     bool
+	TTL        time.Duration // remaining lifetime, negative if it never expires
+	FieldCount int64         // fields Keys returns
+}
+
+// InspectMulti reports existence, remaining lifetime and size of many
+// sessions at once. It takes one round trip for all ids plus two per
+// existing session for its TTL and hidden fields, and slides no expiry.
+func (s *SSDBStore) InspectMulti(ids []session.Id) (infos map[session.Id]SessionInfo, err error) {
+	defer s.observe(&err)
+
+	infos = make(map[session.Id]SessionInfo, len(ids))
+	if len(ids) == 0 {
+		return infos, nil
+	}
+
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(id)
+	}
+	list, err := s.inspect(c, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range list {
+		infos[info.Id] = info
+	}
+	return infos, nil
+}
+
+// IterateInfo is Iterate passing a SessionInfo instead of the id. The
+// field counts of each page of ids come in one extra round trip, the
+// TTLs take one per session.
+func (s *SSDBStore) IterateInfo(fn func(SessionInfo) bool) (err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var inner error
+	err = s.scan(c, func(ids []string) bool {
+		var list []SessionInfo
+		if list, inner = s.inspect(c, ids); inner != nil {
+			return false
+		}
+		for _, info := range list {
+			if !fn(info) {
+				return false
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = inner
+	}
+	return err
+}
+
+// inspect returns the SessionInfo of the SSDB keys in the same order.
+func (s *SSDBStore) inspect(c client, keys []string) ([]SessionInfo, error) {
+	sizes, err := multiHsize(c, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SessionInfo, len(keys))
+	for i, key := range keys {
+		info := SessionInfo{Id: s.id(key)}
+		if size := sizes[key]; size > 0 {
+			hidden, err := s.hiddenFields(c, key)
+			if err != nil {
+				return nil, err
+			}
+			info.Exists = true
+			info.FieldCount = size - hidden
+			ttl, err := c.Ttl(key)
+			if err != nil {
+				return nil, err
+			}
+			info.TTL = time.Duration(ttl) * time.Second
+			if ttl < 0 {
+				info.TTL = -1
+			}
+		}
+		infos[i] = info
+	}
+	return infos, nil
+}
+
+// multiHsize returns the field counts of the hashes which exist.
+func multiHsize(c client, keys []string) (map[string]int64, error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "multi_hsize")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	resp, err := c.Do(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 || resp[0] != "ok" {
+		return nil, fmt.Errorf("multi_hsize failed: %v", resp)
+	}
+	sizes := make(map[string]int64)
+	for i := 1; i+1 < len(resp); i += 2 {
+		n, err := strconv.ParseInt(resp[i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("multi_hsize: bad size %q of %s", resp[i+1], resp[i])
+		}
+		sizes[resp[i]] = n
+	}
+	return sizes, nil
+}
@@ -0,0 +1,90 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestInspectMulti(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute})
+	expect(t, store.Set("present", "a", "1"), nil)
+	expect(t, store.Set("present", "b", "2"), nil)
+	addWithoutTTL(b, "persistent")
+
+	infos, err := store.InspectMulti([]session.Id{"present", "absent", "persistent"})
+	expect(t, err, nil)
+	expect(t, len(infos), 3)
+	expect(t, infos["present"], SessionInfo{Id: "present", Exists: true, TTL: time.Minute, FieldCount: 2})
+	expect(t, infos["absent"], SessionInfo{Id: "absent"})
+	expect(t, infos["persistent"], SessionInfo{Id: "persistent", Exists: true, TTL: -1, FieldCount: 1})
+	expect(t, b.count("multi_hsize"), 1)
+	expect(t, b.count("ttl"), 2)
+	expect(t, b.count("expire"), 2)
+}
+
+func TestIterateInfo(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute, ScanBatchSize: 2})
+	expect(t, store.Set("a", "x", "1"), nil)
+	expect(t, store.Set("b", "x", "1"), nil)
+	expect(t, store.Set("b", "y", "2"), nil)
+	addWithoutTTL(b, "c")
+
+	var infos []SessionInfo
+	expect(t, store.IterateInfo(func(info SessionInfo) bool {
+		infos = append(infos, info)
+		return true
+	}), nil)
+	expect(t, len(infos), 3)
+	expect(t, infos[0], SessionInfo{Id: "a", Exists: true, TTL: time.Minute, FieldCount: 1})
+	expect(t, infos[1], SessionInfo{Id: "b", Exists: true, TTL: time.Minute, FieldCount: 2})
+	expect(t, infos[2], SessionInfo{Id: "c", Exists: true, TTL: -1, FieldCount: 1})
+	expect(t, b.count("multi_hsize"), 2)
+
+	n := 0
+	expect(t, store.IterateInfo(func(info SessionInfo) bool {
+		n++
+		return false
+	}), nil)
+	expect(t, n, 1)
+}
+
+func TestFieldCountHidesReserved(t *testing.T) {
+	store, _ := newMemStore(t, Options{MaxAge: time.Minute})
+	expect(t, store.Add("added"), true)
+	infos, err := store.InspectMulti([]session.Id{"added"})
+	expect(t, err, nil)
+	expect(t, infos["added"], SessionInfo{Id: "added", Exists: true, TTL: time.Minute, FieldCount: 0})
+
+	expect(t, store.Set("added", "a", "1"), nil)
+	expect(t, store.Set("added", "b", "2"), nil)
+	expect(t, store.SetMeta("added", "ip", "127.0.0.1"), nil)
+	infos, err = store.InspectMulti([]session.Id{"added"})
+	expect(t, err, nil)
+	expect(t, infos["added"].FieldCount, int64(2))
+
+	n, err := store.ClearCount("added")
+	expect(t, err, nil)
+	expect(t, n, int64(2))
+	expect(t, store.Exist("added"), false)
+
+	// only Added, the session exists but holds nothing
+	expect(t, store.Add("empty"), true)
+	n, err = store.ClearCount("empty")
+	expect(t, err, nil)
+	expect(t, n, int64(0))
+	expect(t, store.Exist("empty"), false)
+
+	// metadata counts when Keys returns it
+	store, _ = newMemStore(t, Options{IncludeMeta: true})
+	expect(t, store.Add("meta"), true)
+	expect(t, store.SetMeta("meta", "ip", "127.0.0.1"), nil)
+	n, err = store.ClearCount("meta")
+	expect(t, err, nil)
+	expect(t, n, int64(1))
+}
@@ -0,0 +1,20 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"github.com/lunny/log"
+	"github.com/lunny/tango"
+)
+
+// logger returns the logger every message of the store goes through.
+// A store built without New, or whose Logger was set to nil, logs to
+// log.Std, the default New assigns, which is safe for concurrent use.
+func (s *SSDBStore) logger() tango.Logger {
+	if s.Logger == nil {
+		return log.Std
+	}
+	return s.Logger
+}
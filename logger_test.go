@@ -0,0 +1,66 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestNilLogger(t *testing.T) {
+	store, b := newMemStore(t, Options{
+		EventQueue:          "events",
+		FieldNameWarnLength: 1,
+		StaleCacheSize:      8,
+	})
+	store.Logger = nil
+	store.SetMaxAge(1500 * time.Millisecond)
+
+	// every command fails, so each method takes its logging error path
+	expect(t, store.Set("id", "long", "1"), nil)
+	b.setDown(true)
+	for _, cmd := range []string{"qpush", "hget", "hset", "hdel", "exists", "expire", "del"} {
+		b.failWith(cmd, errBackendDown)
+	}
+
+	refute(t, store.Set("id", "long", "1"), nil)
+	store.SetReportingCreate("id", "a", "1")
+	store.Get("id", "a")
+	store.GetStale("id", "long")
+	store.Peek("id", "a")
+	store.DebugGet("id", "a")
+	store.GetFromNode("id", "a")
+	store.Del("id", "a")
+	store.Clear("id")
+	store.ClearCount("id")
+	store.ClearMulti([]session.Id{"id"})
+	store.Add("id")
+	store.Exist("id")
+	store.SetIdMaxAge("id", time.Second)
+	store.Ping()
+	store.Iterate(func(session.Id) bool { return true })
+	store.ApplyMaxAgeToAll()
+	store.Reencode(GobCodec{}, JSONCodec{})
+	store.SetAsync("id", "a", "1")
+	expect(t, store.Close(), nil)
+}
+
+func TestZeroValueLogger(t *testing.T) {
+	var store SSDBStore
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store.logger().Errorf("ssdb zero value store %s", "logs")
+		}()
+	}
+	wg.Wait()
+	refute(t, store.logger(), nil)
+}
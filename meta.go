@@ -0,0 +1,127 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tango-contrib/session"
+)
+
+// MetaPrefix starts the field names SetMeta stores metadata under. Keys
+// and GetAll only return such fields when Options.IncludeMeta is set.
+const MetaPrefix = reservedPrefix + "meta:"
+
+// SetMeta stores server managed metadata, such as the client address or
+// the login time, next to the session data. Metadata lives in its own
+// namespace and can not collide with the keys passed to Set, it expires
+// and is cleared together with the session.
+func (s *SSDBStore) SetMeta(id session.Id, key string, val interface{}) error {
+	return s.Set(id, MetaPrefix+key, val)
+}
+
+// GetMeta returns metadata stored by SetMeta, nil if it is missing.
+func (s *SSDBStore) GetMeta(id session.Id, key string) (value interface{}, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return s.read(c, id, MetaPrefix+key)
+}
+
+// visible reports whether a field name is returned by Keys and GetAll.
+func (s *SSDBStore) visible(key string) bool {
+	if !strings.HasPrefix(key, reservedPrefix) {
+		return true
+	}
+	return s.IncludeMeta && strings.HasPrefix(key, MetaPrefix)
+}
+
+// maxReserved bounds how many reserved field names hiddenFields lists.
+const maxReserved = 1024
+
+// hiddenFields counts the fields of the SSDB key which visible hides, so
+// field counts only report what callers can read. Reserved names sort
+// before all others, so they are listed as a range.
+func (s *SSDBStore) hiddenFields(c client, key string) (int64, error) {
+	resp, err := c.Do("hkeys", key, "", reservedPrefix+"\xff", maxReserved)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) == 0 || resp[0] != "ok" {
+		return 0, fmt.Errorf("hkeys failed: %v", resp)
+	}
+	var n int64
+	for _, field := range resp[1:] {
+		if !s.visible(field) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Keys returns the sorted field names of a session, an empty slice if the
+// session does not exist.
+func (s *SSDBStore) Keys(id session.Id) (keys []string, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if gone, err := s.expired(c, id); gone || err != nil {
+		return []string{}, err
+	}
+	fields, err := c.HgetAll(s.key(id))
+	if err != nil {
+		return nil, err
+	}
+	keys = make([]string, 0, len(fields))
+	for key := range fields {
+		if s.visible(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// GetAll returns the decoded values of all fields of a session. Neither
+// Keys nor GetAll slide the session expiry.
+func (s *SSDBStore) GetAll(id session.Id) (values map[string]interface{}, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	if gone, err := s.expired(c, id); gone || err != nil {
+		return map[string]interface{}{}, err
+	}
+	fields, err := c.HgetAll(s.key(id))
+	if err != nil {
+		return nil, err
+	}
+	values = make(map[string]interface{}, len(fields))
+	for key, raw := range fields {
+		if !s.visible(key) {
+			continue
+		}
+		if values[key], err = s.deserialize(raw.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
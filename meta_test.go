@@ -0,0 +1,50 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMeta(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+
+	expect(t, store.Add("id"), true)
+	expect(t, store.Set("id", "ip", "user value"), nil)
+	expect(t, store.SetMeta("id", "ip", "10.0.0.1"), nil)
+
+	v, err := store.GetMeta("id", "ip")
+	expect(t, err, nil)
+	expect(t, v, "10.0.0.1")
+	expect(t, store.Get("id", "ip"), "user value")
+	v, err = store.GetMeta("id", "agent")
+	expect(t, err, nil)
+	expect(t, v, nil)
+
+	keys, err := store.Keys("id")
+	expect(t, err, nil)
+	expect(t, strings.Join(keys, ","), "ip")
+	all, err := store.GetAll("id")
+	expect(t, err, nil)
+	expect(t, len(all), 1)
+	expect(t, all["ip"], "user value")
+
+	store.IncludeMeta = true
+	keys, err = store.Keys("id")
+	expect(t, err, nil)
+	expect(t, strings.Join(keys, ","), MetaPrefix+"ip,ip")
+	all, err = store.GetAll("id")
+	expect(t, err, nil)
+	expect(t, len(all), 2)
+	expect(t, all[MetaPrefix+"ip"], "10.0.0.1")
+
+	expect(t, store.Clear("id"), true)
+	_, ok := b.field("id", MetaPrefix+"ip")
+	expect(t, ok, false)
+	keys, err = store.Keys("id")
+	expect(t, err, nil)
+	expect(t, len(keys), 0)
+}
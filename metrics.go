@@ -0,0 +1,218 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats are the store's running counters.
+type Stats struct {
+	Acquires int64 // clients taken from the pool
+	Errors   int64 // failed operations
+	InFlight int64 // clients currently in use
+
+	ops    int64 // finished operations
+	writes int64 // write commands sent
+}
+
+// Stats returns a snapshot of the store's counters.
+func (s *SSDBStore) Stats() Stats {
+	return Stats{
+		Acquires: atomic.LoadInt64(&s.stats.Acquires),
+		Errors:   atomic.LoadInt64(&s.stats.Errors),
+		InFlight: atomic.LoadInt64(&s.stats.InFlight),
+	}
+}
+
+// publishExpvar exposes the counters as an expvar map named name.
+func (s *SSDBStore) publishExpvar(name string) error {
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar %s is already published", name)
+	}
+	m := new(expvar.Map).Init()
+	m.Set("acquires", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&s.stats.Acquires)
+	}))
+	m.Set("errors", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&s.stats.Errors)
+	}))
+	m.Set("in_flight", expvar.Func(func() interface{} {
+		return atomic.LoadInt64(&s.stats.InFlight)
+	}))
+	expvar.Publish(name, m)
+	return nil
+}
+
+// countedClient keeps the in flight gauge and the hold time average up
+// to date.
+type countedClient struct {
+	client
+	s        *SSDBStore
+	acquired time.Time
+}
+
+func (c countedClient) Close() {
+	atomic.AddInt64(&c.s.stats.InFlight, -1)
+	c.s.latency.add(c.s.clock.Now().Sub(c.acquired))
+	c.client.Close()
+}
+
+// The write commands of the client are counted for WriteAmplification.
+
+func (c countedClient) Hset(setName, key string, value interface{}) error {
+	atomic.AddInt64(&c.s.stats.writes, 1)
+	return c.client.Hset(setName, key, value)
+}
+
+func (c countedClient) Hdel(setName, key string) error {
+	atomic.AddInt64(&c.s.stats.writes, 1)
+	return c.client.Hdel(setName, key)
+}
+
+func (c countedClient) Del(key string) error {
+	atomic.AddInt64(&c.s.stats.writes, 1)
+	return c.client.Del(key)
+}
+
+func (c countedClient) MultiDel(key ...string) error {
+	atomic.AddInt64(&c.s.stats.writes, 1)
+	return c.client.MultiDel(key...)
+}
+
+func (c countedClient) Expire(key string, ttl int64) (bool, error) {
+	atomic.AddInt64(&c.s.stats.writes, 1)
+	return c.client.Expire(key, ttl)
+}
+
+func (c countedClient) Qpush(name string, value ...interface{}) (int64, error) {
+	atomic.AddInt64(&c.s.stats.writes, 1)
+	return c.client.Qpush(name, value...)
+}
+
+// WriteAmplification returns how many write commands the store sent to
+// the backend per operation, counting every operation, reads included.
+// Sliding the expiry on each Get and Set costs an EXPIRE each, so a mix
+// of Sets and Gets ends up near 1.5, and a higher ratio points at
+// features which write more, such as events or emulated expiry. Zero
+// before the first operation.
+func (s *SSDBStore) WriteAmplification() float64 {
+	ops := atomic.LoadInt64(&s.stats.ops)
+	if ops == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&s.stats.writes)) / float64(ops)
+}
+
+// latencyWeight is how much each new sample moves the latency average.
+const latencyWeight = 0.1
+
+// latencyAverage is an exponentially weighted moving average of how long
+// clients are held, which covers the round trips of an operation.
+type latencyAverage struct {
+	lock sync.Mutex
+	avg  time.Duration
+}
+
+func (l *latencyAverage) add(d time.Duration) {
+	l.lock.Lock()
+	if l.avg == 0 {
+		l.avg = d
+	} else {
+		l.avg += time.Duration(latencyWeight * float64(d-l.avg))
+	}
+	l.lock.Unlock()
+}
+
+func (l *latencyAverage) get() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.avg
+}
+
+// outcomeWindow is how many recent operations ErrorRate can look back on.
+const outcomeWindow = 1024
+
+// outcomeRing remembers when the most recent operations finished and
+// whether they failed.
+type outcomeRing struct {
+	lock   sync.Mutex
+	at     [outcomeWindow]time.Time
+	failed [outcomeWindow]bool
+	next   int
+	size   int
+}
+
+func (r *outcomeRing) add(at time.Time, failed bool) {
+	r.lock.Lock()
+	r.at[r.next] = at
+	r.failed[r.next] = failed
+	r.next = (r.next + 1) % outcomeWindow
+	if r.size < outcomeWindow {
+		r.size++
+	}
+	r.lock.Unlock()
+}
+
+// rate returns the fraction of failed operations finished after since.
+func (r *outcomeRing) rate(since time.Time) float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var total, failed int
+	for i := 1; i <= r.size; i++ {
+		j := (r.next - i + outcomeWindow) % outcomeWindow
+		if r.at[j].Before(since) {
+			break
+		}
+		total++
+		if r.failed[j] {
+			failed++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
+
+// observe records the outcome of an operation, it is deferred by the
+// store's methods with a pointer to their error.
+func (s *SSDBStore) observe(err *error) {
+	now := s.clock.Now()
+	atomic.AddInt64(&s.stats.ops, 1)
+	if *err != nil {
+		atomic.AddInt64(&s.stats.Errors, 1)
+	} else {
+		atomic.StoreInt64(&s.lastSuccess, now.UnixNano())
+	}
+	s.outcomes.add(now, *err != nil)
+}
+
+// LastSuccess returns when an operation last succeeded, the zero time if
+// none has yet. Unlike Ping it costs no round trip, so monitors can poll
+// it to tell whether the store still does real work.
+func (s *SSDBStore) LastSuccess() time.Time {
+	ns := atomic.LoadInt64(&s.lastSuccess)
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// ErrorRate returns the fraction of operations which failed during the
+// trailing window. Only the last 1024 operations are remembered, so on a
+// busy store long windows are cut short. Without operations in the window
+// the rate is zero.
+func (s *SSDBStore) ErrorRate(window time.Duration) (float64, error) {
+	if window <= 0 {
+		return 0, errors.New("window must be positive")
+	}
+	return s.outcomes.rate(s.clock.Now().Add(-window)), nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestErrorRate(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	clock := newFakeClock()
+	store.clock = clock
+
+	_, err := store.ErrorRate(0)
+	refute(t, err, nil)
+
+	rate, err := store.ErrorRate(time.Minute)
+	expect(t, err, nil)
+	expect(t, rate, 0.0)
+
+	// failures which fall out of the window later on
+	b.setDown(true)
+	for i := 0; i < 4; i++ {
+		refute(t, store.Set("id", "a", "1"), nil)
+	}
+	clock.Advance(2 * time.Minute)
+
+	// one failure out of four operations within the window
+	b.setDown(false)
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, store.Exist("id"), true)
+	b.setDown(true)
+	expect(t, store.Del("id", "a"), false)
+
+	rate, err = store.ErrorRate(time.Minute)
+	expect(t, err, nil)
+	expect(t, rate, 0.25)
+
+	rate, err = store.ErrorRate(time.Hour)
+	expect(t, err, nil)
+	expect(t, rate, 5.0/8)
+}
+
+// expvarRuns tells apart the names TestExpvar publishes, which expvar
+// keeps for the whole process, when it runs more than once.
+var expvarRuns int32
+
+func TestExpvar(t *testing.T) {
+	name := fmt.Sprintf("%s_%d", t.Name(), atomic.AddInt32(&expvarRuns, 1))
+	store, b := newMemStore(t, Options{ExpvarName: name})
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Get("id", "a"), "1")
+	b.setDown(true)
+	expect(t, store.Exist("id"), false)
+
+	var vars struct {
+		Acquires int64 `json:"acquires"`
+		Errors   int64 `json:"errors"`
+		InFlight int64 `json:"in_flight"`
+	}
+	err := json.Unmarshal([]byte(expvar.Get(name).String()), &vars)
+	expect(t, err, nil)
+	expect(t, vars.Acquires, int64(2))
+	expect(t, vars.Errors, int64(1))
+	expect(t, vars.InFlight, int64(0))
+	expect(t, store.Stats(), Stats{Acquires: 2, Errors: 1})
+
+	usePools(t, map[string]*memBackend{"mem": b})
+	_, err = New(Options{Host: "mem", ExpvarName: name})
+	refute(t, err, nil)
+}
+
+func TestLastSuccess(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	clock := newFakeClock()
+	store.clock = clock
+	expect(t, store.LastSuccess().IsZero(), true)
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	first := store.LastSuccess()
+	expect(t, first.Equal(clock.Now()), true)
+
+	clock.Advance(time.Minute)
+	b.failWith("hset", errBackendDown)
+	refute(t, store.Set("id", "a", "2"), nil)
+	expect(t, store.LastSuccess().Equal(first), true)
+
+	b.failWith("hset", nil)
+	expect(t, store.Set("id", "a", "3"), nil)
+	expect(t, store.LastSuccess().Equal(clock.Now()), true)
+}
+
+func TestHealthScore(t *testing.T) {
+	store, _ := newMemStore(t, Options{})
+	clock := newFakeClock()
+	store.clock = clock
+	expect(t, store.HealthScore(), 100)
+
+	// a quarter of the recent operations failed
+	for i := 0; i < 4; i++ {
+		store.outcomes.add(clock.Now(), i == 0)
+	}
+	expect(t, store.HealthScore(), 88)
+
+	// clients are held for about 255ms, halfway to slowLatency
+	store.latency.add(255 * time.Millisecond)
+	expect(t, store.HealthScore(), 73)
+
+	// the pool is saturated
+	atomic.StoreInt64(&store.stats.InFlight, int64(store.MaxPoolSize))
+	expect(t, store.HealthScore(), 53)
+
+	// errors age out of the window
+	clock.Advance(2 * time.Minute)
+	score := store.HealthScore()
+	if score < 60 || score > 70 {
+		t.Errorf("score %d, want between 60 and 70", score)
+	}
+
+	// without a pool size the pool never counts as saturated
+	store.MaxPoolSize = 0
+	expect(t, store.HealthScore(), score+20)
+}
+
+func TestWriteAmplification(t *testing.T) {
+	store, _ := newMemStore(t, Options{})
+	expect(t, store.WriteAmplification(), float64(0))
+
+	// HSET and EXPIRE, HGET and EXPIRE, HDEL
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, store.Del("id", "a"), true)
+	expect(t, store.WriteAmplification(), 4.0/3)
+
+	// a miss reads only
+	expect(t, store.Get("id", "a"), nil)
+	expect(t, store.WriteAmplification(), 1.0)
+}
@@ -0,0 +1,86 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Reencode rewrites every stored field, decoding it with from and encoding
+// it with to, and returns how many fields were rewritten. Expiries are
+// left untouched. Fields which do not decode with from but do with to are
+// taken as migrated already, so an interrupted run can simply be started
+// again. Each field is read again right before it is rewritten and left
+// alone if it changed meanwhile, which keeps concurrent Sets from being
+// overwritten except within that last round trip. The values do not
+// record their codec like those of Options.CodecFor, stores reading them
+// afterwards must use to.
+func (s *SSDBStore) Reencode(from, to Codec) (n int, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	err = s.scan(c, func(ids []string) bool {
+		for _, id := range ids {
+			var m int
+			m, err = s.reencodeSession(c, id, from, to)
+			n += m
+			if err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return n, err
+}
+
+func (s *SSDBStore) reencodeSession(c client, id string, from, to Codec) (int, error) {
+	fields, err := c.HgetAll(id)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for key, raw := range fields {
+		if strings.HasPrefix(key, reservedPrefix) && !strings.HasPrefix(key, MetaPrefix) {
+			continue
+		}
+		value, err := s.deserializeWith(from, raw.Bytes())
+		if err != nil {
+			if _, err2 := s.deserializeWith(to, raw.Bytes()); err2 == nil {
+				continue
+			}
+			return n, fmt.Errorf("decode %s:%s: %v", id, key, err)
+		}
+		bs, err := s.encode(to, value, true, false)
+		if err != nil {
+			return n, fmt.Errorf("encode %s:%s: %v", id, key, err)
+		}
+		if bytes.Equal(bs, raw.Bytes()) {
+			continue
+		}
+
+		cur, err := c.Hget(id, key)
+		if err != nil {
+			return n, err
+		}
+		if cur != raw {
+			continue
+		}
+		if err = c.Hset(id, key, bs); err != nil {
+			return n, err
+		}
+		s.cache.forget(s.id(id), key)
+		s.stale.forget(s.id(id), key)
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestReencode(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute})
+
+	expect(t, store.Set("id1", "name", "xlw"), nil)
+	expect(t, store.Set("id1", "user", &Test{1, "lunny"}), nil)
+	expect(t, store.Set("id2", "n", 42), nil)
+	store.SetIdMaxAge("id2", 10*time.Second)
+
+	n, err := store.Reencode(GobCodec{}, JSONCodec{})
+	expect(t, err, nil)
+	expect(t, n, 3)
+
+	raw, _ := b.field("id1", "user")
+	var user map[string]interface{}
+	expect(t, json.Unmarshal([]byte(raw), &user), nil)
+	expect(t, user["Name"], "lunny")
+	raw, _ = b.field("id2", "n")
+	expect(t, raw, "42")
+	expect(t, b.ttl("id1"), int64(60))
+	expect(t, b.ttl("id2"), int64(10))
+
+	v, err := store.deserializeWith(JSONCodec{}, []byte(raw))
+	expect(t, err, nil)
+	expect(t, v, 42.0)
+
+	// running it again finds nothing left to migrate
+	n, err = store.Reencode(GobCodec{}, JSONCodec{})
+	expect(t, err, nil)
+	expect(t, n, 0)
+}
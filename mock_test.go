@@ -0,0 +1,470 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/seefan/gossdb"
+)
+
+var errBackendDown = errors.New("backend down")
+
+// memBackend is an in memory stand-in for a SSDB server.
+type memBackend struct {
+	lock   sync.Mutex
+	down   bool
+	fail   map[string]error         // per command errors
+	failAt map[string]int           // the only call of a command which fails
+	gates  map[string]chan struct{} // block commands until closed
+	hashes map[string]map[string]string
+	ttls   map[string]int64
+	queues map[string][]string
+	names  []string // connection names, kept when naming is set
+	naming bool
+	calls  map[string]int
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{
+		fail:   make(map[string]error),
+		failAt: make(map[string]int),
+		gates:  make(map[string]chan struct{}),
+		hashes: make(map[string]map[string]string),
+		ttls:   make(map[string]int64),
+		queues: make(map[string][]string),
+		calls:  make(map[string]int),
+	}
+}
+
+func (b *memBackend) setDown(down bool) {
+	b.lock.Lock()
+	b.down = down
+	b.lock.Unlock()
+}
+
+func (b *memBackend) failWith(cmd string, err error) {
+	b.lock.Lock()
+	b.fail[cmd] = err
+	b.lock.Unlock()
+}
+
+func (b *memBackend) count(cmd string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.calls[cmd]
+}
+
+func (b *memBackend) ttl(key string) int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.ttls[key]
+}
+
+func (b *memBackend) field(key, field string) (string, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	v, ok := b.hashes[key][field]
+	return v, ok
+}
+
+// failCall makes only the nth call of cmd from now on fail.
+func (b *memBackend) failCall(cmd string, n int) {
+	b.lock.Lock()
+	b.failAt[cmd] = b.calls[cmd] + n
+	b.lock.Unlock()
+}
+
+// block makes cmd wait until the returned channel is closed.
+func (b *memBackend) block(cmd string) chan struct{} {
+	gate := make(chan struct{})
+	b.lock.Lock()
+	b.gates[cmd] = gate
+	b.lock.Unlock()
+	return gate
+}
+
+// enter records a call of cmd, waits while cmd is blocked and reports
+// whether the command fails. It must be called with the lock held.
+func (b *memBackend) enter(cmd string) error {
+	b.calls[cmd]++
+	if gate := b.gates[cmd]; gate != nil {
+		b.lock.Unlock()
+		<-gate
+		b.lock.Lock()
+	}
+	if b.down || b.calls[cmd] == b.failAt[cmd] {
+		return errBackendDown
+	}
+	return b.fail[cmd]
+}
+
+type memPool struct {
+	b *memBackend
+}
+
+func (p memPool) NewClient() (client, error) {
+	p.b.lock.Lock()
+	defer p.b.lock.Unlock()
+	if err := p.b.enter("connect"); err != nil {
+		return nil, err
+	}
+	return &memClient{b: p.b}, nil
+}
+
+func (p memPool) Close() {
+	p.b.lock.Lock()
+	p.b.calls["close"]++
+	p.b.lock.Unlock()
+}
+
+type memClient struct {
+	b *memBackend
+}
+
+func (c *memClient) Close() {}
+
+func (c *memClient) Ping() bool {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	return c.b.enter("ping") == nil
+}
+
+func (c *memClient) Hset(setName, key string, value interface{}) error {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("hset"); err != nil {
+		return err
+	}
+	h, ok := c.b.hashes[setName]
+	if !ok {
+		h = make(map[string]string)
+		c.b.hashes[setName] = h
+		c.b.ttls[setName] = -1
+	}
+	switch v := value.(type) {
+	case []byte:
+		h[key] = string(v)
+	default:
+		h[key] = fmt.Sprint(v)
+	}
+	return nil
+}
+
+func (c *memClient) Hget(setName, key string) (gossdb.Value, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("hget"); err != nil {
+		return "", err
+	}
+	return gossdb.Value(c.b.hashes[setName][key]), nil
+}
+
+func (c *memClient) Hdel(setName, key string) error {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("hdel"); err != nil {
+		return err
+	}
+	delete(c.b.hashes[setName], key)
+	if len(c.b.hashes[setName]) == 0 {
+		delete(c.b.hashes, setName)
+		delete(c.b.ttls, setName)
+	}
+	return nil
+}
+
+func (c *memClient) Hexists(setName, key string) (bool, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("hexists"); err != nil {
+		return false, err
+	}
+	_, ok := c.b.hashes[setName][key]
+	return ok, nil
+}
+
+func (c *memClient) HgetAll(setName string) (map[string]gossdb.Value, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("hgetall"); err != nil {
+		return nil, err
+	}
+	all := make(map[string]gossdb.Value)
+	for k, v := range c.b.hashes[setName] {
+		all[k] = gossdb.Value(v)
+	}
+	return all, nil
+}
+
+func (c *memClient) Hsize(setName string) (int64, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("hsize"); err != nil {
+		return 0, err
+	}
+	return int64(len(c.b.hashes[setName])), nil
+}
+
+func (c *memClient) Hlist(nameStart, nameEnd string, limit int64) ([]string, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("hlist"); err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range c.b.hashes {
+		if name > nameStart && (nameEnd == "" || name <= nameEnd) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if int64(len(names)) > limit {
+		names = names[:limit]
+	}
+	return names, nil
+}
+
+func (c *memClient) Del(key string) error {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("del"); err != nil {
+		return err
+	}
+	delete(c.b.hashes, key)
+	delete(c.b.ttls, key)
+	return nil
+}
+
+func (c *memClient) MultiDel(key ...string) error {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("multi_del"); err != nil {
+		return err
+	}
+	for _, k := range key {
+		delete(c.b.hashes, k)
+		delete(c.b.ttls, k)
+	}
+	return nil
+}
+
+// Do implements the handful of raw commands the store issues.
+func (c *memClient) Do(args ...interface{}) ([]string, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	cmd := fmt.Sprint(args[0])
+	if err := c.b.enter(cmd); err != nil {
+		return nil, err
+	}
+	resp := []string{"ok"}
+	switch cmd {
+	case "multi_exists":
+		for _, k := range args[1:] {
+			_, ok := c.b.hashes[fmt.Sprint(k)]
+			resp = append(resp, fmt.Sprint(k), map[bool]string{true: "1", false: "0"}[ok])
+		}
+	case "multi_hsize":
+		for _, k := range args[1:] {
+			resp = append(resp, fmt.Sprint(k), fmt.Sprint(len(c.b.hashes[fmt.Sprint(k)])))
+		}
+	case "hkeys":
+		// the start is exclusive and the end inclusive, like SSDB
+		start, end := fmt.Sprint(args[2]), fmt.Sprint(args[3])
+		var fields []string
+		for f := range c.b.hashes[fmt.Sprint(args[1])] {
+			if f > start && f <= end {
+				fields = append(fields, f)
+			}
+		}
+		sort.Strings(fields)
+		resp = append(resp, fields...)
+	case "client":
+		if fmt.Sprint(args[1]) != "setname" || !c.b.naming {
+			return []string{"client_error", "unknown command"}, nil
+		}
+		c.b.names = append(c.b.names, fmt.Sprint(args[2]))
+	default:
+		return []string{"client_error", "unknown command"}, nil
+	}
+	return resp, nil
+}
+
+func (c *memClient) Exists(key string) (bool, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("exists"); err != nil {
+		return false, err
+	}
+	_, ok := c.b.hashes[key]
+	return ok, nil
+}
+
+func (c *memClient) Expire(key string, ttl int64) (bool, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("expire"); err != nil {
+		return false, err
+	}
+	if _, ok := c.b.hashes[key]; !ok {
+		return false, nil
+	}
+	c.b.ttls[key] = ttl
+	return true, nil
+}
+
+func (c *memClient) Ttl(key string) (int64, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("ttl"); err != nil {
+		return 0, err
+	}
+	if _, ok := c.b.hashes[key]; !ok {
+		return -1, nil
+	}
+	return c.b.ttls[key], nil
+}
+
+// memLogger records formatted log lines by level.
+type memLogger struct {
+	lock  sync.Mutex
+	lines map[string][]string
+}
+
+func newMemLogger() *memLogger {
+	return &memLogger{lines: make(map[string][]string)}
+}
+
+func (l *memLogger) logf(level, format string, v ...interface{}) {
+	l.lock.Lock()
+	l.lines[level] = append(l.lines[level], fmt.Sprintf(format, v...))
+	l.lock.Unlock()
+}
+
+func (l *memLogger) get(level string) []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.lines[level]...)
+}
+
+func (l *memLogger) Debugf(format string, v ...interface{}) { l.logf("debug", format, v...) }
+func (l *memLogger) Debug(v ...interface{})                 { l.logf("debug", fmt.Sprint(v...)) }
+func (l *memLogger) Infof(format string, v ...interface{})  { l.logf("info", format, v...) }
+func (l *memLogger) Info(v ...interface{})                  { l.logf("info", fmt.Sprint(v...)) }
+func (l *memLogger) Warnf(format string, v ...interface{})  { l.logf("warn", format, v...) }
+func (l *memLogger) Warn(v ...interface{})                  { l.logf("warn", fmt.Sprint(v...)) }
+func (l *memLogger) Errorf(format string, v ...interface{}) { l.logf("error", format, v...) }
+func (l *memLogger) Error(v ...interface{})                 { l.logf("error", fmt.Sprint(v...)) }
+
+func (c *memClient) Qpush(name string, value ...interface{}) (int64, error) {
+	c.b.lock.Lock()
+	defer c.b.lock.Unlock()
+	if err := c.b.enter("qpush"); err != nil {
+		return 0, err
+	}
+	for _, v := range value {
+		switch v := v.(type) {
+		case []byte:
+			c.b.queues[name] = append(c.b.queues[name], string(v))
+		default:
+			c.b.queues[name] = append(c.b.queues[name], fmt.Sprint(v))
+		}
+	}
+	return int64(len(c.b.queues[name])), nil
+}
+
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeTimer{c.now.Add(d), ch})
+	return ch
+}
+
+// Advance moves the clock and fires the timers which became due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiters
+}
+
+// waitForTimers blocks until n timers are pending.
+func (c *fakeClock) waitForTimers(t *testing.T, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		c.lock.Lock()
+		pending := len(c.waiters)
+		c.lock.Unlock()
+		if pending >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d timers, %d pending", n, pending)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// usePools makes New connect to the in memory backends keyed by host.
+func usePools(t *testing.T, backends map[string]*memBackend) {
+	old := newPool
+	newPool = func(cfg *gossdb.Config) (connector, error) {
+		b, ok := backends[cfg.Host]
+		if !ok {
+			return nil, fmt.Errorf("unknown host %s", cfg.Host)
+		}
+		return memPool{b}, nil
+	}
+	t.Cleanup(func() {
+		newPool = old
+	})
+}
+
+// newMemStore returns a store backed by a single in memory backend.
+func newMemStore(t *testing.T, opt Options) (*SSDBStore, *memBackend) {
+	b := newMemBackend()
+	opt.Host = "mem"
+	usePools(t, map[string]*memBackend{"mem": b})
+	store, err := New(opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, b
+}
@@ -0,0 +1,82 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tango-contrib/session"
+)
+
+// SetMulti sets several fields of a session. Before writing, the current
+// values of the fields are read one by one, and when a write fails those already
+// written are restored, or deleted when they did not exist before.
+//
+// SSDB has no transactions, so this is best effort: concurrent writers
+// may observe the partial state, and a rollback which fails itself is
+// logged and leaves the session half written.
+func (s *SSDBStore) SetMulti(id session.Id, values map[string]interface{}) (err error) {
+	defer s.observe(&err)
+
+	if err = s.validateId(id); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(values))
+	encoded := make(map[string][]byte, len(values))
+	for key, val := range values {
+		bs, err := s.serializeFor(id, val)
+		if err != nil {
+			return fmt.Errorf("encode %s: %w", key, err)
+		}
+		keys = append(keys, key)
+		encoded[key] = bs
+	}
+	sort.Strings(keys)
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	prior := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		v, err := c.Hget(s.key(id), key)
+		if err != nil {
+			return err
+		}
+		if !v.IsEmpty() {
+			prior[key] = v.Bytes()
+		}
+	}
+
+	for i, key := range keys {
+		s.cache.forget(id, key)
+		s.stale.forget(id, key)
+		defer s.cache.forget(id, key)
+		if err = s.write(c, id, key, encoded[key]); err != nil {
+			s.rollback(c, id, keys[:i+1], prior)
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback restores fields to the raw values in prior, deleting those
+// missing from it.
+func (s *SSDBStore) rollback(c client, id session.Id, keys []string, prior map[string][]byte) {
+	for _, key := range keys {
+		var err error
+		if old, ok := prior[key]; ok {
+			err = c.Hset(s.key(id), key, old)
+		} else {
+			err = c.Hdel(s.key(id), key)
+		}
+		if err != nil {
+			s.logger().Errorf("ssdb rollback of %s failed: %s", string(id)+":"+key, err)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"testing"
+)
+
+func TestSetMulti(t *testing.T) {
+	store, _ := newMemStore(t, Options{})
+
+	expect(t, store.SetMulti("id", map[string]interface{}{"a": "1", "b": 2}), nil)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, store.Get("id", "b"), 2)
+}
+
+func TestSetMultiRollback(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	expect(t, store.Set("id", "a", "old a"), nil)
+	expect(t, store.Set("id", "c", "old c"), nil)
+
+	// fields are written in key order, the write of c fails after a and b
+	b.failCall("hset", 3)
+	refute(t, store.SetMulti("id", map[string]interface{}{
+		"a": "new a",
+		"b": "new b",
+		"c": "new c",
+	}), nil)
+
+	expect(t, store.Get("id", "a"), "old a")
+	expect(t, store.Get("id", "c"), "old c")
+	_, ok := b.field("id", "b")
+	expect(t, ok, false)
+}
@@ -0,0 +1,60 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestKeyPrefix(t *testing.T) {
+	b := newMemBackend()
+	usePools(t, map[string]*memBackend{"mem": b})
+	shop, err := New(Options{Host: "mem", KeyPrefix: "shop:", MaxAge: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blog, err := New(Options{Host: "mem", KeyPrefix: "blog:", MaxAge: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := New(Options{Host: "mem", MaxAge: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, shop.Set("id", "a", "shop"), nil)
+	expect(t, blog.Set("id", "a", "blog"), nil)
+	expect(t, plain.Set("id", "a", "plain"), nil)
+	_, ok := b.field("shop:id", "a")
+	expect(t, ok, true)
+	expect(t, shop.Get("id", "a"), "shop")
+	expect(t, blog.Get("id", "a"), "blog")
+	expect(t, plain.Get("id", "a"), "plain")
+
+	expect(t, shop.Exist("id"), true)
+	expect(t, shop.Exist("other"), false)
+	shop.SetIdMaxAge("id", time.Hour)
+	expect(t, b.ttl("shop:id"), int64(3600))
+	expect(t, b.ttl("blog:id"), int64(60))
+
+	expect(t, shop.Set("id2", "a", "shop"), nil)
+	var ids []session.Id
+	expect(t, shop.Iterate(func(id session.Id) bool {
+		ids = append(ids, id)
+		return true
+	}), nil)
+	expect(t, len(ids), 2)
+	expect(t, ids[0], session.Id("id"))
+	expect(t, ids[1], session.Id("id2"))
+
+	expect(t, shop.Del("id", "a"), true)
+	expect(t, blog.Get("id", "a"), "blog")
+	expect(t, blog.Clear("id"), true)
+	expect(t, blog.Exist("id"), false)
+	expect(t, plain.Get("id", "a"), "plain")
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrConnect, ErrAuth and ErrPing classify the failures reported by
+	// TestConnection, match them with errors.Is.
+	ErrConnect = errors.New("ssdb connect failed")
+	ErrAuth    = errors.New("ssdb auth failed")
+	ErrPing    = errors.New("ssdb ping failed")
+)
+
+// preflightTimeout bounds each step of TestConnection.
+const preflightTimeout = 5 * time.Second
+
+// TestConnection opens a single connection to the backend described by
+// opts, authenticates when a Password is set, pings and disconnects. It
+// is meant for preflight checks which should not pay for a whole pool.
+func TestConnection(opts Options) error {
+	opt := preOptions([]Options{opts})
+	addr := net.JoinHostPort(opt.Host, strconv.Itoa(opt.Port))
+
+	conn, err := net.DialTimeout("tcp", addr, preflightTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConnect, err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if opt.Password != "" {
+		resp, err := roundTrip(conn, r, "auth", opt.Password)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrConnect, err)
+		}
+		if resp[0] != "ok" {
+			return fmt.Errorf("%w: %s", ErrAuth, strings.Join(resp, " "))
+		}
+	}
+
+	resp, err := roundTrip(conn, r, "ping")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrConnect, err)
+	}
+	if resp[0] != "ok" {
+		return fmt.Errorf("%w: %s", ErrPing, strings.Join(resp, " "))
+	}
+	return nil
+}
+
+// roundTrip sends a command in the SSDB protocol, where every argument
+// is its length and itself on separate lines and a blank line ends the
+// packet, and reads the response packet.
+func roundTrip(conn net.Conn, r *bufio.Reader, args ...string) ([]string, error) {
+	conn.SetDeadline(time.Now().Add(preflightTimeout))
+
+	var buf bytes.Buffer
+	writePacket(&buf, args...)
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	resp, err := readPacket(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 {
+		return nil, errors.New("empty response")
+	}
+	return resp, nil
+}
+
+func readPacket(r *bufio.Reader) ([]string, error) {
+	var blocks []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return blocks, nil
+		}
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("malformed block length %q", line)
+		}
+		data := make([]byte, n+1)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, string(data[:n]))
+	}
+}
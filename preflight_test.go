@@ -0,0 +1,90 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveSSDB answers ping and auth with password on a local port, failing
+// pings if pingFails is set.
+func serveSSDB(t *testing.T, password string, pingFails bool) (string, int) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				authed := password == ""
+				for {
+					req, err := readPacket(r)
+					if err != nil {
+						return
+					}
+					resp := []string{"ok"}
+					switch {
+					case req[0] == "auth" && req[1] == password:
+						authed = true
+						resp = append(resp, "1")
+					case req[0] == "auth":
+						resp = []string{"error", "invalid password"}
+					case !authed:
+						resp = []string{"noauth", "authentication required"}
+					case pingFails:
+						resp = []string{"error", "loading"}
+					}
+					for _, block := range resp {
+						fmt.Fprintf(conn, "%d\n%s\n", len(block), block)
+					}
+					fmt.Fprint(conn, "\n")
+				}
+			}()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestTestConnection(t *testing.T) {
+	host, port := serveSSDB(t, "", false)
+	expect(t, TestConnection(Options{Host: host, Port: port}), nil)
+
+	host, port = serveSSDB(t, "secret", false)
+	expect(t, TestConnection(Options{Host: host, Port: port, Password: "secret"}), nil)
+
+	err := TestConnection(Options{Host: host, Port: port, Password: "wrong"})
+	expect(t, errors.Is(err, ErrAuth), true)
+	expect(t, strings.Contains(err.Error(), "invalid password"), true)
+	err = TestConnection(Options{Host: host, Port: port})
+	expect(t, errors.Is(err, ErrPing), true)
+
+	host, port = serveSSDB(t, "", true)
+	err = TestConnection(Options{Host: host, Port: port})
+	expect(t, errors.Is(err, ErrPing), true)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port = l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	err = TestConnection(Options{Host: "127.0.0.1", Port: port})
+	expect(t, errors.Is(err, ErrConnect), true)
+}
@@ -0,0 +1,143 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// noTTL is what SSDB's TTL reports for a key which never expires.
+const noTTL = -1
+
+// RepairMissingTTL gives every stored session without an expiry the
+// current MaxAge and returns how many were repaired. Such sessions are
+// left behind by writes whose EXPIRE failed and would never go away. It
+// fails with ErrNoKeyPrefix unless KeyPrefix tells sessions apart from
+// the other hashes on the server.
+func (s *SSDBStore) RepairMissingTTL() (n int, err error) {
+	defer s.observe(&err)
+	if s.KeyPrefix == "" {
+		return 0, ErrNoKeyPrefix
+	}
+
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	err = s.scan(c, func(ids []string) bool {
+		var m int
+		m, err = s.repairTTL(c, ids)
+		n += m
+		return err == nil
+	})
+	return n, err
+}
+
+// repairTTL sets the expiry of those ids which have none.
+func (s *SSDBStore) repairTTL(c client, ids []string) (int, error) {
+	ttl := s.maxSeconds()
+	if ttl <= 0 || s.emulatedExpiry {
+		return 0, nil
+	}
+
+	n := 0
+	for _, id := range ids {
+		cur, err := c.Ttl(id)
+		if err != nil {
+			return n, err
+		}
+		if cur != noTTL {
+			continue
+		}
+		ok, err := s.expire(c, s.id(id), ttl)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	if n > 0 {
+		atomic.AddInt64(&s.ttlRepair.repaired, int64(n))
+	}
+	return n, nil
+}
+
+// ttlRepair runs the background loop enabled by Options.TTLRepairInterval.
+type ttlRepair struct {
+	repaired int64 // sessions repaired by the loop or RepairMissingTTL
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+	next string // last id of the previous batch
+}
+
+// TTLRepaired returns how many sessions got their missing expiry repaired.
+func (s *SSDBStore) TTLRepaired() int64 {
+	return atomic.LoadInt64(&s.ttlRepair.repaired)
+}
+
+// startTTLRepair checks TTLRepairBatch sessions every TTLRepairInterval,
+// resuming where the previous batch ended and wrapping around at the
+// end, so the whole store is covered without a burst of commands.
+func (s *SSDBStore) startTTLRepair() {
+	r := &s.ttlRepair
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-s.clock.After(s.TTLRepairInterval):
+			}
+			if err := s.repairBatch(); err != nil {
+				s.logger().Errorf("ssdb TTL repair failed: %s", err)
+			}
+		}
+	}()
+}
+
+func (s *SSDBStore) repairBatch() (err error) {
+	defer s.observe(&err)
+	if s.KeyPrefix == "" {
+		return ErrNoKeyPrefix
+	}
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	r := &s.ttlRepair
+	ids, err := s.list(c, r.next, s.TTLRepairBatch)
+	if err != nil {
+		return err
+	}
+	if len(ids) < s.TTLRepairBatch {
+		r.next = ""
+	} else {
+		r.next = ids[len(ids)-1]
+	}
+	_, err = s.repairTTL(c, ids)
+	return err
+}
+
+// stopLoop stops the loop if it runs and waits for it to finish.
+func (r *ttlRepair) stopLoop() {
+	if r.stop == nil {
+		return
+	}
+	r.once.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+}
@@ -0,0 +1,80 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// addWithoutTTL stores sessions the way a write with a failed EXPIRE
+// leaves them behind.
+func addWithoutTTL(b *memBackend, ids ...string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, id := range ids {
+		b.hashes[id] = map[string]string{"a": "1"}
+		b.ttls[id] = -1
+	}
+}
+
+func TestRepairMissingTTL(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute, ScanBatchSize: 2, KeyPrefix: "s:"})
+
+	expect(t, store.Set("fine", "a", "1"), nil)
+	addWithoutTTL(b, "s:lost1", "s:lost2", "s:lost3", "foreign")
+
+	n, err := store.RepairMissingTTL()
+	expect(t, err, nil)
+	expect(t, n, 3)
+	expect(t, b.ttl("s:lost2"), int64(60))
+	expect(t, b.ttl("foreign"), int64(-1))
+	expect(t, store.TTLRepaired(), int64(3))
+
+	n, err = store.RepairMissingTTL()
+	expect(t, err, nil)
+	expect(t, n, 0)
+
+	// without a prefix other hashes on the server can not be told apart
+	store.KeyPrefix = ""
+	_, err = store.RepairMissingTTL()
+	expect(t, err, ErrNoKeyPrefix)
+	expect(t, b.ttl("foreign"), int64(-1))
+
+	usePools(t, map[string]*memBackend{"mem": b})
+	_, err = New(Options{Host: "mem", TTLRepairInterval: time.Second})
+	expect(t, err, ErrNoKeyPrefix)
+}
+
+func TestTTLRepairLoop(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute, TTLRepairBatch: 2, KeyPrefix: "s:"})
+	for i := 0; i < 5; i++ {
+		addWithoutTTL(b, fmt.Sprintf("s:id%d", i))
+	}
+
+	clock := newFakeClock()
+	store.clock = clock
+	store.TTLRepairInterval = time.Second
+	store.startTTLRepair()
+
+	for _, want := range []int64{2, 4, 5, 5} {
+		clock.waitForTimers(t, 1)
+		clock.Advance(time.Second)
+		clock.waitForTimers(t, 1)
+		expect(t, store.TTLRepaired(), want)
+	}
+	expect(t, b.ttl("s:id4"), int64(60))
+
+	// the loop keeps cycling, the fourth batch wrapped around to id0 and id1
+	addWithoutTTL(b, "s:id3")
+	clock.Advance(time.Second)
+	clock.waitForTimers(t, 1)
+	expect(t, store.TTLRepaired(), int64(6))
+
+	expect(t, store.Close(), nil)
+	clock.Advance(time.Second)
+	expect(t, store.TTLRepaired(), int64(6))
+}
@@ -0,0 +1,119 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+)
+
+// replayBuffer keeps async writes which failed, in the order they were
+// made and with only the last write of each field.
+type replayBuffer struct {
+	lock    sync.Mutex
+	entries *list.List // of asyncWrite
+	index   map[staleKey]*list.Element
+}
+
+// retain adds a failed write, replacing an older one for the same field.
+// When the buffer is full the oldest write is dropped and returned.
+func (r *replayBuffer) retain(w asyncWrite, size int) (dropped *asyncWrite) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.entries == nil {
+		r.entries = list.New()
+		r.index = make(map[staleKey]*list.Element)
+	}
+
+	k := staleKey{w.id, w.key}
+	if e, ok := r.index[k]; ok {
+		r.entries.Remove(e)
+	} else if r.entries.Len() >= size {
+		oldest := r.entries.Remove(r.entries.Front()).(asyncWrite)
+		delete(r.index, staleKey{oldest.id, oldest.key})
+		dropped = &oldest
+	}
+	r.index[k] = r.entries.PushBack(w)
+	return dropped
+}
+
+// take empties the buffer and returns its writes in order.
+func (r *replayBuffer) take() []asyncWrite {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.entries == nil {
+		return nil
+	}
+	writes := make([]asyncWrite, 0, r.entries.Len())
+	for e := r.entries.Front(); e != nil; e = e.Next() {
+		writes = append(writes, e.Value.(asyncWrite))
+	}
+	r.entries.Init()
+	r.index = make(map[staleKey]*list.Element)
+	return writes
+}
+
+// putBack returns writes which could not be replayed to the front of the
+// buffer, unless the field was written again meanwhile. Being the oldest,
+// those which do not fit into size any more are dropped and returned.
+func (r *replayBuffer) putBack(writes []asyncWrite, size int) (dropped []asyncWrite) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for i := len(writes) - 1; i >= 0; i-- {
+		k := staleKey{writes[i].id, writes[i].key}
+		if _, ok := r.index[k]; ok {
+			continue
+		}
+		if r.entries.Len() >= size {
+			dropped = append(dropped, writes[i])
+			continue
+		}
+		r.index[k] = r.entries.PushFront(writes[i])
+	}
+	return dropped
+}
+
+// ReplayPending returns how many failed async writes wait to be replayed.
+func (s *SSDBStore) ReplayPending() int {
+	s.replays.lock.Lock()
+	defer s.replays.lock.Unlock()
+	if s.replays.entries == nil {
+		return 0
+	}
+	return s.replays.entries.Len()
+}
+
+// retainFailed keeps a failed async write for replay if enabled.
+func (s *SSDBStore) retainFailed(w asyncWrite, err error) {
+	if s.ReplayBufferSize <= 0 || errors.Is(err, ErrValueTooLarge) {
+		return
+	}
+	if dropped := s.replays.retain(w, s.ReplayBufferSize); dropped != nil {
+		s.logDropped(*dropped)
+	}
+}
+
+func (s *SSDBStore) logDropped(w asyncWrite) {
+	s.logger().Errorf("ssdb replay buffer full, dropped write of %s", string(w.id)+":"+w.key)
+}
+
+// replay applies the retained writes on c, stopping at the first failure.
+func (s *SSDBStore) replay(c client) {
+	writes := s.replays.take()
+	for i, w := range writes {
+		s.cache.forget(w.id, w.key)
+		s.stale.forget(w.id, w.key)
+		err := s.write(c, w.id, w.key, w.bs)
+		s.cache.forget(w.id, w.key)
+		if err != nil {
+			s.logger().Errorf("ssdb replay of %s failed: %s", string(w.id)+":"+w.key, err)
+			for _, d := range s.replays.putBack(writes[i:], s.ReplayBufferSize) {
+				s.logDropped(d)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestReplayAfterOutage(t *testing.T) {
+	errs := make(chan string, 10)
+	store, b := newMemStore(t, Options{
+		AsyncWorkers:     1,
+		ReplayBufferSize: 2,
+		OnError: func(op string, id session.Id, key string, err error) {
+			errs <- key
+		},
+	})
+	b.setDown(true)
+
+	for _, w := range []struct{ key, val string }{
+		{"a", "1"}, {"b", "2"}, {"a", "3"}, {"c", "4"},
+	} {
+		expect(t, store.SetAsync("id", w.key, w.val), nil)
+		<-errs
+	}
+	// a was written twice, then c pushed the oldest write, b, out
+	expect(t, store.ReplayPending(), 2)
+
+	refute(t, store.Ping(), nil)
+	expect(t, store.ReplayPending(), 2)
+
+	b.setDown(false)
+	expect(t, store.Ping(), nil)
+	expect(t, store.ReplayPending(), 0)
+	expect(t, store.Get("id", "a"), "3")
+	expect(t, store.Get("id", "b"), nil)
+	expect(t, store.Get("id", "c"), "4")
+	expect(t, store.Close(), nil)
+}
+
+func TestReplayStopsAtFailure(t *testing.T) {
+	errs := make(chan string, 10)
+	store, b := newMemStore(t, Options{
+		AsyncWorkers:     1,
+		ReplayBufferSize: 10,
+		OnError: func(op string, id session.Id, key string, err error) {
+			errs <- key
+		},
+	})
+	b.setDown(true)
+	for _, key := range []string{"a", "b", "c"} {
+		expect(t, store.SetAsync("id", key, key), nil)
+		<-errs
+	}
+
+	b.setDown(false)
+	b.failCall("hset", 2)
+	expect(t, store.Ping(), nil)
+	expect(t, store.ReplayPending(), 2)
+	expect(t, store.Get("id", "a"), "a")
+
+	expect(t, store.Ping(), nil)
+	expect(t, store.ReplayPending(), 0)
+	expect(t, store.Get("id", "c"), "c")
+	expect(t, store.Close(), nil)
+}
+
+func TestReplayPutBackBounded(t *testing.T) {
+	var r replayBuffer
+	r.retain(asyncWrite{"id", "a", nil}, 2)
+	r.retain(asyncWrite{"id", "b", nil}, 2)
+	writes := r.take()
+
+	// a write retained while replaying leaves room for only one
+	r.retain(asyncWrite{"id", "c", nil}, 2)
+	dropped := r.putBack(writes, 2)
+	expect(t, len(dropped), 1)
+	expect(t, dropped[0].key, "a")
+	expect(t, r.entries.Len(), 2)
+	expect(t, r.entries.Front().Value.(asyncWrite).key, "b")
+}
+
+func TestReplayForgetsCaches(t *testing.T) {
+	errs := make(chan string, 10)
+	store, b := newMemStore(t, Options{
+		AsyncWorkers:     1,
+		ReplayBufferSize: 10,
+		ReadCacheTTL:     time.Minute,
+		StaleCacheSize:   10,
+		OnError: func(op string, id session.Id, key string, err error) {
+			errs <- key
+		},
+	})
+	expect(t, store.Set("id", "a", "old"), nil)
+
+	b.failWith("hset", errBackendDown)
+	expect(t, store.SetAsync("id", "a", "new"), nil)
+	<-errs
+	// reads still work and cache the value the failed write left behind
+	expect(t, store.Get("id", "a"), "old")
+
+	b.failWith("hset", nil)
+	expect(t, store.Ping(), nil)
+	expect(t, store.ReplayPending(), 0)
+	expect(t, store.Get("id", "a"), "new")
+	b.setDown(true)
+	v, stale := store.GetStale("id", "a")
+	expect(t, v, "new")
+	expect(t, stale, true)
+	b.setDown(false)
+	expect(t, store.Close(), nil)
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"github.com/tango-contrib/session"
+)
+
+// Iterate calls fn for every stored session id in key order, fetching
+// ScanBatchSize ids per round trip, until fn returns false.
+func (s *SSDBStore) Iterate(fn func(session.Id) bool) (err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return s.scan(c, func(ids []string) bool {
+		for _, id := range ids {
+			if !fn(s.id(id)) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// scan pages through the SSDB keys of all sessions on c, passing each
+// page to fn until fn returns false.
+func (s *SSDBStore) scan(c client, fn func(ids []string) bool) error {
+	start := ""
+	for {
+		ids, err := s.list(c, start, s.ScanBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 || !fn(ids) || len(ids) < s.ScanBatchSize {
+			return nil
+		}
+		start = ids[len(ids)-1]
+	}
+}
+
+// list returns up to limit SSDB keys of sessions following start, from
+// the first one if start is empty.
+func (s *SSDBStore) list(c client, start string, limit int) ([]string, error) {
+	if s.KeyPrefix == "" {
+		return c.Hlist(start, "", int64(limit))
+	}
+	if start == "" {
+		start = s.KeyPrefix
+	}
+	return c.Hlist(start, s.KeyPrefix+"\xff", int64(limit))
+}
+
+// ApplyMaxAgeToAll resets the expiry of every stored session to the
+// current MaxAge and returns how many sessions were updated. It costs one
+// round trip per session on top of the scan, so on large stores it is
+// meant for occasional maintenance after SetMaxAge, not the request path.
+// Without a KeyPrefix the scan also finds the hashes of other
+// applications, so then only sessions carrying the marker of Add are
+// updated.
+func (s *SSDBStore) ApplyMaxAgeToAll() (n int, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	ttl := s.maxSeconds()
+	err = s.scan(c, func(ids []string) bool {
+		for _, id := range ids {
+			var ok bool
+			if s.KeyPrefix == "" {
+				if ok, err = c.Hexists(id, sessionMarker); err != nil {
+					return false
+				}
+				if !ok {
+					continue
+				}
+			}
+			ok, err = s.expire(c, s.id(id), ttl)
+			if err != nil {
+				return false
+			}
+			if ok {
+				n++
+			}
+		}
+		return true
+	})
+	return n, err
+}
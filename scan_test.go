@@ -0,0 +1,79 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestIterateBatches(t *testing.T) {
+	store, b := newMemStore(t, Options{ScanBatchSize: 2})
+
+	for i := 0; i < 5; i++ {
+		expect(t, store.Set(session.Id(fmt.Sprintf("id%d", i)), "a", "1"), nil)
+	}
+
+	var ids []string
+	err := store.Iterate(func(id session.Id) bool {
+		ids = append(ids, string(id))
+		return true
+	})
+	expect(t, err, nil)
+	expect(t, sliceEq(ids, []string{"id0", "id1", "id2", "id3", "id4"}), true)
+	expect(t, b.count("hlist"), 3)
+
+	ids = nil
+	err = store.Iterate(func(id session.Id) bool {
+		ids = append(ids, string(id))
+		return len(ids) < 3
+	})
+	expect(t, err, nil)
+	expect(t, len(ids), 3)
+}
+
+func TestApplyMaxAgeToAll(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute, ScanBatchSize: 2, KeyPrefix: "s:"})
+
+	for i := 0; i < 3; i++ {
+		expect(t, store.Set(session.Id(fmt.Sprintf("id%d", i)), "a", "1"), nil)
+	}
+	addWithoutTTL(b, "foreign")
+	expect(t, b.ttl("s:id0"), int64(60))
+
+	store.SetMaxAge(time.Hour)
+	n, err := store.ApplyMaxAgeToAll()
+	expect(t, err, nil)
+	expect(t, n, 3)
+	for i := 0; i < 3; i++ {
+		expect(t, b.ttl(fmt.Sprintf("s:id%d", i)), int64(3600))
+	}
+	expect(t, b.ttl("foreign"), int64(-1))
+
+	// without a prefix only sessions marked by Add are touched
+	store, b = newMemStore(t, Options{MaxAge: time.Minute})
+	expect(t, store.Add("added"), true)
+	addWithoutTTL(b, "foreign")
+	store.SetMaxAge(time.Hour)
+	n, err = store.ApplyMaxAgeToAll()
+	expect(t, err, nil)
+	expect(t, n, 1)
+	expect(t, b.ttl("added"), int64(3600))
+	expect(t, b.ttl("foreign"), int64(-1))
+}
+
+func TestScanBatchSizeValidation(t *testing.T) {
+	usePools(t, map[string]*memBackend{"mem": newMemBackend()})
+
+	_, err := New(Options{Host: "mem", ScanBatchSize: -1})
+	refute(t, err, nil)
+
+	store, err := New(Options{Host: "mem"})
+	expect(t, err, nil)
+	expect(t, store.ScanBatchSize, 100)
+}
@@ -6,12 +6,18 @@ package ssdbstore
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-	"unsafe"
 
 	"github.com/lunny/log"
 	"github.com/lunny/tango"
@@ -21,22 +27,311 @@ import (
 
 var _ session.Store = &SSDBStore{}
 
+var errPing = errors.New("ping failed")
+
 type Options struct {
 	Host     string
 	Port     int
 	Password string
 	DbIndex  int
 	MaxAge   time.Duration
+
+	// MinPoolSize, MaxPoolSize and AcquireIncrement size the connection
+	// pool of each backend: clients kept open, the most open at once and
+	// how many are opened when more are needed. They default to 5, 50
+	// and 5.
+	MinPoolSize      int
+	MaxPoolSize      int
+	AcquireIncrement int
+
+	// StandbyHost and StandbyPort address a warm standby the store
+	// switches to once the primary has been unreachable for
+	// PromotionGrace, and switches back from once the primary has been
+	// healthy again for the same period. Meanwhile the primary is probed
+	// once per PromotionGrace, so switching back takes up to twice that.
+	StandbyHost    string
+	StandbyPort    int
+	PromotionGrace time.Duration
+
+	// ReadCacheTTL enables an in process cache of Get results kept for
+	// this long. Only writes through this store invalidate it, writes of
+	// other processes show up once entries expire, so keep it short.
+	// Cached reads do not slide the session expiry.
+	ReadCacheTTL time.Duration
+
+	// IdValidator, when set, is consulted by Add and Set; ids it rejects
+	// are refused with an error matching ErrWeakId.
+	IdValidator func(session.Id) error
+
+	// ScanBatchSize is how many session ids scanning operations like
+	// Iterate fetch per round trip, 100 by default.
+	ScanBatchSize int
+
+	// DedupeGets makes concurrent Gets of the same id and key share a
+	// single backend call. All of them receive the same value, so stored
+	// pointers are shared between the callers.
+	DedupeGets bool
+
+	// EventQueue names a SSDB queue receiving an Event whenever a session
+	// is added or cleared. Publishing is best effort, failures are only
+	// logged.
+	EventQueue string
+
+	// ExpvarName, when set, publishes the store's connection and error
+	// counters through expvar under this name, see Stats.
+	ExpvarName string
+
+	// StaleCacheSize bounds how many recently read values GetStale may
+	// serve while the backend is unreachable, zero disables it.
+	StaleCacheSize int
+
+	// Checksum appends a CRC32 to stored values, reads verify it and fail
+	// with ErrChecksumMismatch on corrupted data. Values are recognized on
+	// read either way, so it can be toggled on a live store.
+	Checksum bool
+
+	// OnError is told about failures which can not be returned to the
+	// caller, like those of writes queued by SetAsync.
+	OnError func(op string, id session.Id, key string, err error)
+
+	// AsyncWorkers and AsyncQueueSize size the background writers of
+	// SetAsync, 4 workers and 1024 queued writes by default.
+	AsyncWorkers   int
+	AsyncQueueSize int
+
+	// SerializeTimeout bounds how long encoding a value may take before
+	// the write fails with ErrSerializeTimeout, zero means no limit.
+	SerializeTimeout time.Duration
+
+	// FieldNameWarnLength logs a warning for every write to a field whose
+	// name is longer than this, which usually means data ended up in the
+	// key. Zero disables the warning, see FieldNameLengths.
+	FieldNameWarnLength int
+
+	// AfterSet is called with the serialized size of every value written
+	// successfully. It runs on the writing goroutine and must return
+	// quickly, hand the numbers off if aggregating them is expensive.
+	AfterSet func(id session.Id, key string, serializedBytes int)
+
+	// IncludeMeta makes Keys and GetAll return the fields written by
+	// SetMeta, under their MetaPrefix names.
+	IncludeMeta bool
+
+	// TTLRepairInterval runs a background loop which gives sessions
+	// without an expiry the current MaxAge, checking TTLRepairBatch
+	// sessions (10 by default) per interval. Zero disables the loop, see
+	// RepairMissingTTL and TTLRepaired. The loop needs a KeyPrefix, New
+	// fails with ErrNoKeyPrefix without one.
+	TTLRepairInterval time.Duration
+	TTLRepairBatch    int
+
+	// Fingerprint stores a hash of the structure of each value's type
+	// with it. When a value decodes into a type whose structure changed
+	// since it was written, for example after a deploy altered a struct,
+	// Get still returns the value but calls OnFingerprintMismatch, as such
+	// decodes may be silently wrong. Values without a fingerprint are
+	// never reported.
+	Fingerprint           bool
+	OnFingerprintMismatch func(id session.Id, key string, value interface{})
+
+	// ClientName labels every new connection as ClientName-<n> so the
+	// server's client list shows which application holds it. Servers
+	// without a client naming command are silently left alone.
+	ClientName string
+
+	// CompressThreshold deflates encoded values of at least this many
+	// bytes when that makes them smaller, zero disables compression. Reads
+	// detect compressed values either way, see SetNoCompress.
+	CompressThreshold int
+
+	// SafeLegacyStructs reads structs which older versions stored by
+	// value without resorting to package unsafe, see GobCodec. Turn it on
+	// when sessions from before pointers were required may still exist,
+	// after they expired or were rewritten it is no longer needed.
+	SafeLegacyStructs bool
+
+	// PoolConnectRetries makes New retry creating a connection pool that
+	// many times, so an application starting before its SSDB server does
+	// not fail right away. The first retry waits PoolConnectBackoff, every
+	// further one twice as long as the one before.
+	PoolConnectRetries int
+	PoolConnectBackoff time.Duration
+
+	// CheckExpire makes New probe whether the server can expire hashes,
+	// which some very old SSDB builds can not, and fail with
+	// ErrExpireUnsupported if it can not. With EmulateExpire such a server
+	// is accepted instead: every write records when the session expires
+	// and reads such as Get and Exist remove sessions past it, at the
+	// cost of a round trip per read. Sessions which are never read again
+	// are not removed. Setting
+	// EmulateExpire implies CheckExpire.
+	CheckExpire   bool
+	EmulateExpire bool
+
+	// LargeValueLogThreshold logs, at info level, every stored value read
+	// or written whose size exceeds this many bytes. Zero disables it.
+	LargeValueLogThreshold int
+
+	// ReplayBufferSize keeps up to that many SetAsync writes which failed,
+	// for example during a short outage, and writes them again in order
+	// the next time Ping succeeds. Only the last write of each field is
+	// kept, and once the buffer is full the oldest writes are dropped and
+	// logged. A replayed write may overwrite a newer value stored by a
+	// synchronous Set or another process meanwhile, and writes still
+	// buffered when the process exits are lost, so this narrows the gap
+	// of an outage rather than guaranteeing delivery. Zero disables it.
+	ReplayBufferSize int
+
+	// KeyPrefix is put in front of every session id to form the SSDB key
+	// of its hash, so applications sharing a server can not see each
+	// other's sessions. Scans only visit keys with the prefix.
+	KeyPrefix string
+
+	// VerifyClear makes Clear and ClearCount check that the session is
+	// gone after deleting it and delete it once more if it is not, which
+	// covers a DEL of a large session failing halfway. If the session
+	// still exists Clear reports false and ClearCount returns
+	// ErrNotCleared.
+	VerifyClear bool
+
+	// Codec encodes the values of the store, GobCodec by default. With
+	// JSONCodec, programs in other languages can read and write session
+	// values directly, as long as Checksum, Fingerprint and compression
+	// stay off, which wrap values in binary envelopes. JSON does not keep
+	// Go types: a struct stored by Set comes back from Get as a
+	// map[string]interface{} and numbers as float64, see JSONCodec.
+	// Changing the codec of a store with sessions needs Reencode first.
+	Codec Codec
+
+	// CodecFor selects the codec new values of a session are encoded
+	// with, for example JSON for sessions other services read as well.
+	// Returning nil picks the store's codec. Values encoded with another
+	// codec than the store's record which one, so they can be read
+	// whatever CodecFor returns later. Codecs must be registered with
+	// RegisterCodec.
+	CodecFor func(id session.Id) Codec
+
+	// MinTTL is the shortest expiry the store sets, longer than any
+	// request should take. Shorter ones, from a tiny MaxAge or a value
+	// passed to SetIdMaxAge or SetWithMaxAge, are raised to it, as they
+	// would make sessions vanish right away. A tiny MaxAge is logged once,
+	// the values passed on every call. Zero disables it.
+	MinTTL time.Duration
 }
 
 // SSDBStore represents a redis session store implementation.
 type SSDBStore struct {
 	Options
-	Logger tango.Logger
-	pool   *gossdb.Connectors
+	Logger  tango.Logger
+	pool    connector
+	standby *standby
+	clock   clock
+	cache   *readCache
+	stale   *staleCache
+	flights *flightGroup
+
+	lastSuccess  int64 // unix nanoseconds, see LastSuccess
+	minTTLWarned int64 // TTL plus one of the last MinTTL raise logged
+
+	emulatedExpiry bool   // the server can not expire hashes, see expire
+	closing        uint32 // set once Close was called
+	closed         uint32 // set once pending writes are done and pools close
+	noSliding      int32  // WithoutSliding calls running
+
+	ttlWarned  uint32 // set once the MaxAge precision warning was logged
+	outcomes   outcomeRing
+	latency    latencyAverage
+	stats      Stats
+	async      asyncWriter
+	replays    replayBuffer
+	fieldNames fieldNameStats
+	ttlRepair  ttlRepair
+	namer      clientNamer
+}
+
+// client is the subset of *gossdb.Client used by the store.
+type client interface {
+	Close()
+	Ping() bool
+	Hset(setName, key string, value interface{}) error
+	Hget(setName, key string) (gossdb.Value, error)
+	Hdel(setName, key string) error
+	Hexists(setName, key string) (bool, error)
+	Hsize(setName string) (int64, error)
+	HgetAll(setName string) (map[string]gossdb.Value, error)
+	Hlist(nameStart, nameEnd string, limit int64) ([]string, error)
+	Del(key string) error
+	MultiDel(key ...string) error
+	Exists(key string) (bool, error)
+	Expire(key string, ttl int64) (bool, error)
+	Ttl(key string) (int64, error)
+	Qpush(name string, value ...interface{}) (int64, error)
+	Do(args ...interface{}) ([]string, error)
+}
+
+// connector hands out pooled clients.
+type connector interface {
+	NewClient() (client, error)
+	Close()
+}
+
+type gossdbPool struct {
+	*gossdb.Connectors
+}
+
+func (p gossdbPool) NewClient() (client, error) {
+	c, err := p.Connectors.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newPool creates the connection pool for a backend, tests replace it.
+var newPool = func(cfg *gossdb.Config) (connector, error) {
+	pool, err := gossdb.NewPool(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return gossdbPool{pool}, nil
+}
+
+// sleep waits between pool connection attempts, tests replace it.
+var sleep = time.Sleep
+
+// openPool runs newPool, retrying as configured by opt.
+func openPool(opt Options, host string, port int) (connector, error) {
+	backoff := opt.PoolConnectBackoff
+	for attempt := 0; ; attempt++ {
+		pool, err := newPool(poolConfig(opt, host, port))
+		if err == nil || attempt >= opt.PoolConnectRetries {
+			return pool, err
+		}
+		sleep(backoff)
+		backoff *= 2
+	}
+}
+
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
 }
 
 func (r *SSDBStore) maxSeconds() int64 {
+	if r.MaxAge%time.Second != 0 && atomic.CompareAndSwapUint32(&r.ttlWarned, 0, 1) {
+		r.logger().Warnf("ssdb session MaxAge %v has sub-second precision, TTLs are truncated to %v",
+			r.MaxAge, r.MaxAge/time.Second*time.Second)
+	}
 	return int64(r.MaxAge / time.Second)
 }
 
@@ -54,85 +349,418 @@ func preOptions(opts []Options) Options {
 	if opt.MaxAge == 0 {
 		opt.MaxAge = session.DefaultMaxAge
 	}
+	if opt.ScanBatchSize == 0 {
+		opt.ScanBatchSize = 100
+	}
+	if opt.AsyncWorkers == 0 {
+		opt.AsyncWorkers = 4
+	}
+	if opt.AsyncQueueSize == 0 {
+		opt.AsyncQueueSize = 1024
+	}
+	if opt.TTLRepairBatch == 0 {
+		opt.TTLRepairBatch = 10
+	}
+	if opt.Codec == nil {
+		opt.Codec = GobCodec{SafeLegacyStructs: opt.SafeLegacyStructs}
+	}
+	if opt.MinPoolSize == 0 {
+		opt.MinPoolSize = 5
+	}
+	if opt.MaxPoolSize == 0 {
+		opt.MaxPoolSize = 50
+	}
+	if opt.AcquireIncrement == 0 {
+		opt.AcquireIncrement = 5
+	}
+	if opt.StandbyHost != "" && opt.StandbyPort == 0 {
+		opt.StandbyPort = 6380
+	}
 	return opt
 }
 
+func poolConfig(opt Options, host string, port int) *gossdb.Config {
+	return &gossdb.Config{
+		Host:             host,
+		Port:             port,
+		MinPoolSize:      opt.MinPoolSize,
+		MaxPoolSize:      opt.MaxPoolSize,
+		AcquireIncrement: opt.AcquireIncrement,
+	}
+}
+
 // NewSSDBStore creates and returns a redis session store.
 func New(opts ...Options) (*SSDBStore, error) {
 	opt := preOptions(opts)
-	pool, err := gossdb.NewPool(&gossdb.Config{
-		Host:             opt.Host,
-		Port:             opt.Port,
-		MinPoolSize:      5,
-		MaxPoolSize:      50,
-		AcquireIncrement: 5,
-	})
+	if opt.ScanBatchSize < 0 {
+		return nil, fmt.Errorf("ScanBatchSize must be positive, got %d", opt.ScanBatchSize)
+	}
+	if opt.TTLRepairBatch < 0 {
+		return nil, fmt.Errorf("TTLRepairBatch must be positive, got %d", opt.TTLRepairBatch)
+	}
+	if opt.TTLRepairInterval > 0 && opt.KeyPrefix == "" {
+		return nil, ErrNoKeyPrefix
+	}
+	if opt.MinPoolSize < 0 || opt.AcquireIncrement < 0 {
+		return nil, fmt.Errorf("MinPoolSize and AcquireIncrement must be positive, got %d and %d",
+			opt.MinPoolSize, opt.AcquireIncrement)
+	}
+	if opt.MaxPoolSize < opt.MinPoolSize {
+		return nil, fmt.Errorf("MaxPoolSize %d is below MinPoolSize %d", opt.MaxPoolSize, opt.MinPoolSize)
+	}
+	if opt.PoolConnectRetries < 0 {
+		return nil, fmt.Errorf("PoolConnectRetries must not be negative, got %d", opt.PoolConnectRetries)
+	}
 
+	pool, err := openPool(opt, opt.Host, opt.Port)
 	if err != nil {
 		return nil, err
 	}
 
-	return &SSDBStore{
+	store := &SSDBStore{
 		Options: opt,
 		pool:    pool,
 		Logger:  log.Std,
-	}, nil
+		clock:   realClock{},
+	}
+	if opt.ReadCacheTTL > 0 {
+		store.cache = newReadCache(opt.ReadCacheTTL)
+	}
+	if opt.StaleCacheSize > 0 {
+		store.stale = newStaleCache(opt.StaleCacheSize)
+	}
+	if opt.DedupeGets {
+		store.flights = &flightGroup{calls: make(map[string]*flight)}
+	}
+
+	if opt.StandbyHost != "" {
+		standbyPool, err := openPool(opt, opt.StandbyHost, opt.StandbyPort)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		store.standby = &standby{
+			pool:  standbyPool,
+			grace: opt.PromotionGrace,
+		}
+	}
+
+	if opt.ExpvarName != "" {
+		if err = store.publishExpvar(opt.ExpvarName); err != nil {
+			pool.Close()
+			if store.standby != nil {
+				store.standby.pool.Close()
+			}
+			return nil, err
+		}
+	}
+
+	if opt.CheckExpire || opt.EmulateExpire {
+		if err = store.checkExpire(); err != nil {
+			store.Close()
+			return nil, err
+		}
+	}
+
+	if opt.TTLRepairInterval > 0 {
+		store.startTTLRepair()
+	}
+	return store, nil
 }
 
-func (c *SSDBStore) serialize(value interface{}) ([]byte, error) {
-	err := c.registerGobConcreteType(value)
+// EffectiveOptions returns the options in use after defaults were applied.
+func (s *SSDBStore) EffectiveOptions() Options {
+	return s.Options
+}
+
+// key returns the SSDB key of the hash holding a session.
+func (s *SSDBStore) key(id session.Id) string {
+	return s.KeyPrefix + string(id)
+}
+
+// id returns the session stored under an SSDB key returned by list.
+func (s *SSDBStore) id(key string) session.Id {
+	return session.Id(strings.TrimPrefix(key, s.KeyPrefix))
+}
+
+func (s *SSDBStore) validateId(id session.Id) error {
+	if s.IdValidator == nil {
+		return nil
+	}
+	err := s.IdValidator(id)
+	if err == nil || errors.Is(err, ErrWeakId) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrWeakId, err)
+}
+
+// conn returns a client of the backend currently serving requests.
+func (s *SSDBStore) conn() (client, error) {
+	c, _, err := s.nodeConn()
+	return c, err
+}
+
+// nodeConn is conn also returning the host:port of the serving backend.
+func (s *SSDBStore) nodeConn() (client, string, error) {
+	if atomic.LoadUint32(&s.closed) != 0 {
+		return nil, "", ErrClosed
+	}
+
+	var c client
+	var err error
+	onStandby := false
+	if s.standby == nil {
+		c, err = s.pool.NewClient()
+	} else {
+		c, onStandby, err = s.standby.conn(s.pool, s.clock.Now())
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", classify(err)
 	}
+	if s.ClientName != "" {
+		s.namer.name(c, s.ClientName)
+	}
+	atomic.AddInt64(&s.stats.Acquires, 1)
+	atomic.AddInt64(&s.stats.InFlight, 1)
 
-	if reflect.TypeOf(value).Kind() == reflect.Struct {
-		return nil, fmt.Errorf("serialize func only take pointer of a struct")
+	node := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	if onStandby {
+		node = net.JoinHostPort(s.StandbyHost, strconv.Itoa(s.StandbyPort))
 	}
+	return countedClient{classifiedClient{c}, s, s.clock.Now()}, node, nil
+}
 
-	var b bytes.Buffer
-	encoder := gob.NewEncoder(&b)
+// binaryMarker prefixes values stored through encoding.BinaryMarshaler.
+// A gob stream always starts with a message length whose first byte is
+// either below 0x80 or at least 0xf8, so a marker in between can never be
+// mistaken for gob data written by older versions.
+const binaryMarker byte = 0x80
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+
+	binaryTypesLock sync.RWMutex
+	binaryTypes     = make(map[string]reflect.Type)
+)
 
-	err = encoder.Encode(&value)
+// binaryTypeName returns the registry name of t, or "" when values of t
+// can not round trip through the binary marshaling interfaces.
+func binaryTypeName(t reflect.Type) string {
+	et, star := t, ""
+	if t.Kind() == reflect.Ptr {
+		et, star = t.Elem(), "*"
+	}
+	if et.Name() == "" || !t.Implements(binaryMarshalerType) ||
+		!reflect.PtrTo(et).Implements(binaryUnmarshalerType) {
+		return ""
+	}
+	return star + et.PkgPath() + "." + et.Name()
+}
+
+// RegisterBinaryType records the type of value so that values implementing
+// encoding.BinaryMarshaler can be decoded by a process which has not stored
+// one itself yet, much like gob.Register does for gob encoded values.
+func RegisterBinaryType(value interface{}) error {
+	t := reflect.TypeOf(value)
+	if t == nil {
+		return errors.New("can not register nil value")
+	}
+	name := binaryTypeName(t)
+	if name == "" {
+		return fmt.Errorf("%v does not implement encoding.BinaryMarshaler and encoding.BinaryUnmarshaler", t)
+	}
+	registerBinaryName(name, t)
+	return nil
+}
+
+func registerBinaryName(name string, t reflect.Type) {
+	binaryTypesLock.Lock()
+	binaryTypes[name] = t
+	binaryTypesLock.Unlock()
+}
+
+func serializeBinary(name string, m encoding.BinaryMarshaler) ([]byte, error) {
+	data, err := m.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
+
+	var b bytes.Buffer
+	var n [binary.MaxVarintLen64]byte
+	b.WriteByte(binaryMarker)
+	b.Write(n[:binary.PutUvarint(n[:], uint64(len(name)))])
+	b.WriteString(name)
+	b.Write(data)
 	return b.Bytes(), nil
 }
 
-func (c *SSDBStore) deserialize(byt []byte) (ptr interface{}, err error) {
-	b := bytes.NewBuffer(byt)
-	decoder := gob.NewDecoder(b)
+func deserializeBinary(byt []byte) (interface{}, error) {
+	l, k := binary.Uvarint(byt)
+	if k <= 0 || uint64(len(byt)-k) < l {
+		return nil, errors.New("malformed binary value header")
+	}
+	name := string(byt[k : k+int(l)])
+
+	binaryTypesLock.RLock()
+	t, ok := binaryTypes[name]
+	binaryTypesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("type %s not registered, call RegisterBinaryType first", name)
+	}
 
-	var p interface{}
-	err = decoder.Decode(&p)
+	et := t
+	if t.Kind() == reflect.Ptr {
+		et = t.Elem()
+	}
+	pv := reflect.New(et)
+	err := pv.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(byt[k+int(l):])
 	if err != nil {
-		return
+		return nil, err
+	}
+	if t.Kind() == reflect.Ptr {
+		return pv.Interface(), nil
 	}
+	return pv.Elem().Interface(), nil
+}
+
+// serialize encodes value with the store codec and wraps it in the
+// envelopes enabled by the options.
+func (c *SSDBStore) serialize(value interface{}) ([]byte, error) {
+	return c.serializeWith(c.codec(), value)
+}
 
-	v := reflect.ValueOf(p)
-	if v.Kind() == reflect.Struct {
-		var pp interface{} = &p
-		datas := reflect.ValueOf(pp).Elem().InterfaceData()
+// serializeFor is serialize using the codec selected for id.
+func (c *SSDBStore) serializeFor(id session.Id, value interface{}) ([]byte, error) {
+	return c.serializeWith(c.codecFor(id), value)
+}
 
-		sp := reflect.NewAt(v.Type(),
-			unsafe.Pointer(datas[1])).Interface()
-		ptr = sp
-	} else {
-		ptr = p
+func (c *SSDBStore) serializeWith(codec Codec, value interface{}) ([]byte, error) {
+	return c.encode(codec, value, true, !sameCodec(codec, c.codec()))
+}
+
+// encode is serializeWith, compressing only when allowed to and
+// recording the codec when told to.
+func (c *SSDBStore) encode(codec Codec, value interface{}, compressible, recordCodec bool) ([]byte, error) {
+	bs, err := c.marshalTimeout(codec, value)
+	if err != nil {
+		return nil, err
+	}
+	if recordCodec && len(bs) > 0 && bs[0] != binaryMarker {
+		if bs, err = addCodecMarker(codec, bs); err != nil {
+			return nil, err
+		}
+	}
+	if compressible && c.CompressThreshold > 0 && len(bs) >= c.CompressThreshold {
+		bs = compress(bs)
+	}
+	if c.Fingerprint {
+		bs = addFingerprint(bs, value)
+	}
+	if c.Checksum {
+		bs = addChecksum(bs)
+	}
+	return bs, nil
+}
+
+// marshalTimeout runs marshal, giving up after SerializeTimeout. The
+// encoding goroutine of a timed out value keeps running until it is done.
+func (c *SSDBStore) marshalTimeout(codec Codec, value interface{}) ([]byte, error) {
+	if c.SerializeTimeout <= 0 {
+		return marshal(codec, value)
+	}
+
+	type result struct {
+		bs  []byte
+		err error
 	}
-	return
+	done := make(chan result, 1)
+	go func() {
+		bs, err := marshal(codec, value)
+		done <- result{bs, err}
+	}()
+
+	timer := time.NewTimer(c.SerializeTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.bs, r.err
+	case <-timer.C:
+		return nil, ErrSerializeTimeout
+	}
+}
+
+// deserialize unwraps the envelopes found on byt and decodes the value
+// with the store codec.
+func (c *SSDBStore) deserialize(byt []byte) (interface{}, error) {
+	return c.deserializeWith(c.codec(), byt)
+}
+
+func (c *SSDBStore) deserializeWith(codec Codec, byt []byte) (interface{}, error) {
+	payload, err := unwrap(byt)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > 0 && payload[0] == codecMarker {
+		if codec, payload, err = c.stripCodecMarker(payload); err != nil {
+			return nil, err
+		}
+	}
+	return unmarshal(codec, payload)
 }
 
-func (c *SSDBStore) registerGobConcreteType(value interface{}) error {
+// unwrap verifies and strips the envelopes of a stored value.
+func unwrap(byt []byte) ([]byte, error) {
+	for len(byt) > 0 && byt[0] == checksumMarker {
+		var err error
+		if byt, err = verifyChecksum(byt); err != nil {
+			return nil, err
+		}
+	}
+	if len(byt) > 0 && byt[0] == fingerprintMarker {
+		var err error
+		if byt, err = stripFingerprint(byt); err != nil {
+			return nil, err
+		}
+	}
+	if len(byt) > 0 && byt[0] == compressMarker {
+		return decompress(byt)
+	}
+	return byt, nil
+}
+
+// marshal encodes value through encoding.BinaryMarshaler when possible
+// and codec is gob, with codec otherwise.
+func marshal(codec Codec, value interface{}) ([]byte, error) {
+	if m, ok := value.(encoding.BinaryMarshaler); ok && isGob(codec) {
+		if name := binaryTypeName(reflect.TypeOf(value)); name != "" {
+			registerBinaryName(name, reflect.TypeOf(value))
+			return serializeBinary(name, m)
+		}
+	}
+	return codec.Marshal(value)
+}
+
+func unmarshal(codec Codec, byt []byte) (interface{}, error) {
+	if len(byt) > 0 && byt[0] == binaryMarker {
+		return deserializeBinary(byt[1:])
+	}
+	return codec.Unmarshal(byt)
+}
+
+func registerGobConcreteType(value interface{}) error {
 	t := reflect.TypeOf(value)
 
 	switch t.Kind() {
 	case reflect.Ptr:
 		v := reflect.ValueOf(value)
+		if v.IsNil() {
+			return fmt.Errorf("can not store a nil %v", t)
+		}
 		i := v.Elem().Interface()
-		gob.Register(i)
+		return gobRegister(i)
 	case reflect.Struct, reflect.Map, reflect.Slice:
-		gob.Register(value)
+		return gobRegister(value)
 	case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Bool, reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
 		// do nothing since already registered known type
 	default:
@@ -141,130 +769,552 @@ func (c *SSDBStore) registerGobConcreteType(value interface{}) error {
 	return nil
 }
 
+// gobRegister calls gob.Register, turning its panic on a name already
+// taken by a different type into an error.
+func gobRegister(value interface{}) (err error) {
+	if _, ok := gobNames.Load(reflect.TypeOf(value)); ok {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gob register %T: %v, use RegisterTypeName to register it under a unique name", value, r)
+		}
+	}()
+	gob.Register(value)
+	return nil
+}
+
+// RegisterTypeName registers value with gob under name, for types whose
+// default gob name collides with another type's. It must be called with
+// the same name in every process sharing the sessions, before storing or
+// reading such values.
+func RegisterTypeName(name string, value interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gob register %T as %s: %v", value, name, r)
+		}
+	}()
+	gob.RegisterName(name, value)
+	gobNames.Store(reflect.TypeOf(value), name)
+	return nil
+}
+
+// gobNames holds the types registered through RegisterTypeName, which
+// serialize must not register again under their default name.
+var gobNames sync.Map
+
 // Set sets value to given key in session.
-func (s *SSDBStore) Set(id session.Id, key string, val interface{}) error {
-	bs, err := s.serialize(val)
+func (s *SSDBStore) Set(id session.Id, key string, val interface{}) (err error) {
+	defer s.observe(&err)
+
+	if err = s.validateId(id); err != nil {
+		return err
+	}
+	s.cache.forget(id, key)
+	defer s.cache.forget(id, key)
+	s.stale.forget(id, key)
+
+	bs, err := s.serializeFor(id, val)
 	if err != nil {
 		return err
 	}
 
-	c, err := s.pool.NewClient()
+	c, err := s.conn()
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
-	err = c.Hset(string(id), key, bs)
-	if err == nil {
-		_, err = c.Expire(string(id), s.maxSeconds())
+	return s.write(c, id, key, bs)
+}
+
+// write stores serialized bytes in a field and slides the session expiry.
+func (s *SSDBStore) write(c client, id session.Id, key string, bs []byte) error {
+	return s.writeTTL(c, id, key, bs, s.maxSeconds())
+}
+
+// writeTTL is write setting the session expiry to seconds.
+func (s *SSDBStore) writeTTL(c client, id session.Id, key string, bs []byte, seconds int64) error {
+	s.fieldNames.track(s, id, key)
+	s.logLarge("writing", id, key, len(bs))
+
+	err := c.Hset(s.key(id), key, bs)
+	if err != nil {
+		return valueTooLarge(err, key, len(bs))
 	}
 
+	_, err = s.expire(c, id, seconds)
+	if err == nil && s.AfterSet != nil {
+		s.AfterSet(id, key, len(bs))
+	}
 	return err
 }
 
+// logLarge reports a value above LargeValueLogThreshold.
+func (s *SSDBStore) logLarge(action string, id session.Id, key string, size int) {
+	if s.LargeValueLogThreshold > 0 && size > s.LargeValueLogThreshold {
+		s.logger().Infof("ssdb session %s: %s large value of %d bytes for %q", id, action, size, key)
+	}
+}
+
+// SetWithMaxAge sets a value like Set, but gives the session maxAge to
+// live instead of MaxAge.
+func (s *SSDBStore) SetWithMaxAge(id session.Id, key string, val interface{}, maxAge time.Duration) (err error) {
+	defer s.observe(&err)
+
+	if err = s.validateId(id); err != nil {
+		return err
+	}
+	s.cache.forget(id, key)
+	defer s.cache.forget(id, key)
+	s.stale.forget(id, key)
+
+	bs, err := s.serializeFor(id, val)
+	if err != nil {
+		return err
+	}
+
+	c, err := s.conn()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return s.writeTTL(c, id, key, bs, s.atLeastMinTTL(id, int64(maxAge/time.Second)))
+}
+
+// SetReportingCreate sets a value like Set and reports whether the field
+// did not exist before. The check costs an extra round trip and is not
+// atomic with the write, concurrent writers may both see created.
+func (s *SSDBStore) SetReportingCreate(id session.Id, key string, val interface{}) (created bool, err error) {
+	defer s.observe(&err)
+
+	if err = s.validateId(id); err != nil {
+		return false, err
+	}
+	s.cache.forget(id, key)
+	defer s.cache.forget(id, key)
+	s.stale.forget(id, key)
+
+	bs, err := s.serializeFor(id, val)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := s.conn()
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+
+	exists, err := c.Hexists(s.key(id), key)
+	if err != nil {
+		return false, err
+	}
+	if err = s.write(c, id, key, bs); err != nil {
+		return false, err
+	}
+	return !exists, nil
+}
+
 // Get gets value by given key in session.
 func (s *SSDBStore) Get(id session.Id, key string) interface{} {
-	c, err := s.pool.NewClient()
+	if v, ok := s.cache.get(id, key, s.clock.Now()); ok {
+		return v
+	}
+	if s.flights != nil {
+		return s.flights.do(string(id)+"\x00"+key, func() interface{} {
+			return s.get(id, key)
+		})
+	}
+	return s.get(id, key)
+}
+
+func (s *SSDBStore) get(id session.Id, key string) interface{} {
+	var err error
+	defer s.observe(&err)
+
+	c, err := s.conn()
 	if err != nil {
-		s.Logger.Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
+		s.logger().Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
 		return nil
 	}
 	defer c.Close()
 
-	v, err := c.Hget(string(id), key)
+	var value interface{}
+	value, err = s.read(c, id, key)
+	return value
+}
+
+// read fetches and decodes a field on c, sliding the session expiry
+// unless WithoutSliding is running.
+// Failures are logged and returned, a missing field is nil without error.
+func (s *SSDBStore) read(c client, id session.Id, key string) (interface{}, error) {
+	gen := s.cache.generation()
+	v, err := c.Hget(s.key(id), key)
 	if err != nil {
-		s.Logger.Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
-		return nil
+		s.logger().Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
+		return nil, err
 	}
 	if v.IsEmpty() {
-		return nil
+		return nil, nil
+	}
+	s.logLarge("read", id, key, len(v))
+	if gone, err := s.expired(c, id); gone || err != nil {
+		if err != nil {
+			s.logger().Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
+		}
+		return nil, err
 	}
 
-	_, err = c.Expire(string(id), s.maxSeconds())
-	if err != nil {
-		s.Logger.Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
-		return nil
+	if s.sliding() {
+		_, err = s.expire(c, id, s.maxSeconds())
+		if err != nil {
+			s.logger().Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
+			return nil, err
+		}
 	}
 
 	value, err := s.deserialize(v.Bytes())
 	if err != nil {
-		s.Logger.Errorf("ssdb HGET %s failed: %s %s", string(id)+":"+key, string(v), err)
-		return nil
+		s.logger().Errorf("ssdb HGET %s failed: %s %s", string(id)+":"+key, string(v), err)
+		return nil, err
 	}
-	return value
+	s.checkFingerprint(id, key, v.Bytes(), value)
+	s.cache.put(id, key, value, s.clock.Now(), gen)
+	s.stale.put(id, key, value)
+	return value, nil
+}
+
+// GetStale reads a value like Get, but when the backend can not be
+// reached, or the read fails with ErrConnectionClosed or ErrTimeout, it
+// answers from a bounded cache of recently read values and reports stale
+// as true. It needs Options.StaleCacheSize, writes are not
+// cached and keep failing during an outage.
+func (s *SSDBStore) GetStale(id session.Id, key string) (value interface{}, stale bool) {
+	var err error
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		if v, ok := s.stale.get(id, key); ok {
+			return v, true
+		}
+		s.logger().Errorf("ssdb HGET %s failed: %s", string(id)+":"+key, err)
+		return nil, false
+	}
+	defer c.Close()
+
+	value, err = s.read(c, id, key)
+	if errors.Is(err, ErrConnectionClosed) || errors.Is(err, ErrTimeout) {
+		if v, ok := s.stale.get(id, key); ok {
+			return v, true
+		}
+	}
+	return value, false
+}
+
+// Peek reads a value like Get but neither slides the session expiry nor
+// logs, and reports whether the field was found. A missing session or
+// field is not an error.
+func (s *SSDBStore) Peek(id session.Id, key string) (value interface{}, found bool, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return nil, false, err
+	}
+	defer c.Close()
+
+	v, err := c.Hget(s.key(id), key)
+	if err != nil {
+		return nil, false, err
+	}
+	if v.IsEmpty() {
+		return nil, false, nil
+	}
+	if gone, err := s.expired(c, id); gone || err != nil {
+		return nil, false, err
+	}
+
+	value, err = s.deserialize(v.Bytes())
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
 }
 
 // Delete delete a key from session.
 func (s *SSDBStore) Del(id session.Id, key string) bool {
-	c, err := s.pool.NewClient()
+	var err error
+	defer s.observe(&err)
+	s.cache.forget(id, key)
+	defer s.cache.forget(id, key)
+	s.stale.forget(id, key)
+
+	c, err := s.conn()
 	if err != nil {
-		s.Logger.Errorf("ssdb HGET failed: %s", err)
+		s.logger().Errorf("ssdb HGET failed: %s", err)
 		return false
 	}
 	defer c.Close()
 
-	err = c.Hdel(string(id), key)
+	err = c.Hdel(s.key(id), key)
 	return err == nil
 }
 
 func (s *SSDBStore) Clear(id session.Id) bool {
-	c, err := s.pool.NewClient()
+	var err error
+	defer s.observe(&err)
+	s.cache.forgetAll(id)
+	defer s.cache.forgetAll(id)
+	s.stale.forgetAll(id)
+
+	c, err := s.conn()
 	if err != nil {
-		s.Logger.Errorf("ssdb HGET failed: %s", err)
+		s.logger().Errorf("ssdb HGET failed: %s", err)
 		return false
 	}
 	defer c.Close()
 
-	err = c.Del(string(id))
-	return err == nil
+	err = s.remove(c, id)
+	if err != nil {
+		return false
+	}
+	s.publish(c, id, EventClear)
+	return true
+}
+
+// remove deletes the hash of a session. With VerifyClear it checks the
+// hash is gone afterwards, even when DEL failed as the outcome of a
+// failed DEL on a large hash is unknown, and deletes it once more if not.
+func (s *SSDBStore) remove(c client, id session.Id) error {
+	err := c.Del(s.key(id))
+	if !s.VerifyClear {
+		return err
+	}
+	for retried := false; ; retried = true {
+		exists, xerr := c.Exists(s.key(id))
+		if xerr != nil {
+			return xerr
+		}
+		if !exists {
+			return nil
+		}
+		if retried && err == nil {
+			return ErrNotCleared
+		}
+		if retried {
+			return fmt.Errorf("%w: %w", ErrNotCleared, err)
+		}
+		err = c.Del(s.key(id))
+	}
+}
+
+// ClearCount removes the whole session like Clear and returns how many
+// fields it held, leaving out those Keys hides. A missing session
+// reports zero.
+func (s *SSDBStore) ClearCount(id session.Id) (n int64, err error) {
+	defer s.observe(&err)
+	s.cache.forgetAll(id)
+	defer s.cache.forgetAll(id)
+	s.stale.forgetAll(id)
+
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	size, err := c.Hsize(s.key(id))
+	if err != nil {
+		return 0, err
+	}
+	if size == 0 {
+		return 0, nil
+	}
+	hidden, err := s.hiddenFields(c, s.key(id))
+	if err != nil {
+		return 0, err
+	}
+	if err = s.remove(c, id); err != nil {
+		return 0, err
+	}
+	s.publish(c, id, EventClear)
+	return size - hidden, nil
+}
+
+// ClearMulti removes several sessions in two round trips and returns how
+// many of them existed. Missing ids are not an error.
+func (s *SSDBStore) ClearMulti(ids []session.Id) (n int, err error) {
+	defer s.observe(&err)
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	for _, id := range ids {
+		s.cache.forgetAll(id)
+		s.stale.forgetAll(id)
+		defer s.cache.forgetAll(id)
+	}
+
+	c, err := s.conn()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.key(id)
+	}
+	existing, err := multiExists(c, keys)
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) == 0 {
+		return 0, nil
+	}
+	if err = c.MultiDel(keys...); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if existing[s.key(id)] {
+			s.publish(c, id, EventClear)
+		}
+	}
+	return len(existing), nil
+}
+
+// multiExists returns the set of keys which exist, in one round trip.
+func multiExists(c client, keys []string) (map[string]bool, error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "multi_exists")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	resp, err := c.Do(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 || resp[0] != "ok" {
+		return nil, fmt.Errorf("multi_exists failed: %v", resp)
+	}
+	existing := make(map[string]bool)
+	for i := 1; i+1 < len(resp); i += 2 {
+		if resp[i+1] == "1" {
+			existing[resp[i]] = true
+		}
+	}
+	return existing, nil
 }
 
 func (s *SSDBStore) Add(id session.Id) bool {
+	if err := s.validateId(id); err != nil {
+		s.logger().Errorf("ssdb session add failed: %s", err)
+		return false
+	}
+
+	return s.create(id)
+}
+
+const (
+	// reservedPrefix starts the fields which belong to the store, not
+	// to users.
+	reservedPrefix = "\x00"
+
+	// sessionMarker is the field Add writes so a session exists before
+	// anything was Set.
+	sessionMarker = reservedPrefix + "created"
+)
+
+// create writes the session marker with the session expiry. The marker
+// is not a user field, so unlike write it skips AfterSet and the field
+// name and value size checks.
+func (s *SSDBStore) create(id session.Id) bool {
+	var err error
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		s.logger().Errorf("ssdb HSET %s failed: %s", string(id)+":"+sessionMarker, err)
+		return false
+	}
+	defer c.Close()
+
+	if err = c.Hset(s.key(id), sessionMarker, []byte{1}); err == nil {
+		_, err = s.expire(c, id, s.maxSeconds())
+	}
+	if err != nil {
+		s.logger().Errorf("ssdb HSET %s failed: %s", string(id)+":"+sessionMarker, err)
+		return false
+	}
+	s.publish(c, id, EventAdd)
 	return true
 }
 
 func (s *SSDBStore) Exist(id session.Id) bool {
-	c, err := s.pool.NewClient()
+	has, err := s.ExistE(id)
 	if err != nil {
-		s.Logger.Errorf("ssdb HGET failed: %s", err)
-		return false
+		s.logger().Errorf("ssdb HGET failed: %s", err)
+	}
+	return has
+}
+
+// ExistE is Exist telling a missing session apart from a failure to ask
+// the backend. The bool is only meaningful when the error is nil.
+func (s *SSDBStore) ExistE(id session.Id) (has bool, err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
+	if err != nil {
+		return false, err
 	}
 	defer c.Close()
-	has, err := c.Exists(string(id))
-	return err == nil && has
+	if gone, err := s.expired(c, id); gone || err != nil {
+		return false, err
+	}
+	return c.Exists(s.key(id))
 }
 
 func (s *SSDBStore) SetMaxAge(maxAge time.Duration) {
 	s.MaxAge = maxAge
+	atomic.StoreUint32(&s.ttlWarned, 0)
+	atomic.StoreInt64(&s.minTTLWarned, 0)
 }
 
 func (s *SSDBStore) SetIdMaxAge(id session.Id, maxAge time.Duration) {
 	if s.Exist(id) {
-		c, err := s.pool.NewClient()
+		var err error
+		defer s.observe(&err)
+
+		c, err := s.conn()
 		if err != nil {
-			s.Logger.Errorf("ssdb HGET failed: %s", err)
+			s.logger().Errorf("ssdb HGET failed: %s", err)
 			return
 		}
 		defer c.Close()
 
-		_, err = c.Expire(string(id), int64(maxAge/time.Second))
+		_, err = s.expire(c, id, s.atLeastMinTTL(id, int64(maxAge/time.Second)))
 		if err != nil {
-			s.Logger.Errorf("ssdb HGET failed: %s", err)
+			s.logger().Errorf("ssdb HGET failed: %s", err)
 			return
 		}
 	}
 }
 
-func (s *SSDBStore) Ping() error {
-	c, err := s.pool.NewClient()
+func (s *SSDBStore) Ping() (err error) {
+	defer s.observe(&err)
+
+	c, err := s.conn()
 	if err != nil {
 		return err
 	}
 	defer c.Close()
 
 	if !c.Ping() {
-		return errors.New("ping failed")
+		return errPing
 	}
+	s.replay(c)
 	return nil
 }
 
@@ -6,6 +6,8 @@ package ssdbstore
 
 import (
 	"bytes"
+	"encoding/gob"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -16,6 +18,7 @@ import (
 	"time"
 
 	"github.com/lunny/tango"
+	"github.com/seefan/gossdb"
 	"github.com/tango-contrib/session"
 )
 
@@ -200,6 +203,447 @@ func TestSession2(t *testing.T) {
 	expect(t, buff.String(), "")
 }
 
+func TestEffectiveOptions(t *testing.T) {
+	store, _ := newMemStore(t, Options{StandbyHost: "mem"})
+
+	opt := store.EffectiveOptions()
+	expect(t, opt.Host, "mem")
+	expect(t, opt.Port, 6380)
+	expect(t, opt.MaxAge, session.DefaultMaxAge)
+	expect(t, opt.StandbyPort, 6380)
+}
+
+func TestMaxAgePrecisionWarning(t *testing.T) {
+	store, _ := newMemStore(t, Options{MaxAge: 90500 * time.Millisecond})
+	logger := newMemLogger()
+	store.Logger = logger
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Set("id", "b", "2"), nil)
+	expect(t, store.Get("id", "a"), "1")
+
+	warns := logger.get("warn")
+	expect(t, len(warns), 1)
+	expect(t, strings.Contains(warns[0], "1m30s"), true)
+
+	store.SetMaxAge(time.Minute)
+	expect(t, store.Set("id", "c", "3"), nil)
+	expect(t, len(logger.get("warn")), 1)
+}
+
+func TestClearCount(t *testing.T) {
+	store, _ := newMemStore(t, Options{})
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Set("id", "b", "2"), nil)
+	expect(t, store.Set("id", "c", "3"), nil)
+
+	n, err := store.ClearCount("id")
+	expect(t, err, nil)
+	expect(t, n, int64(3))
+	expect(t, store.Exist("id"), false)
+
+	n, err = store.ClearCount("missing")
+	expect(t, err, nil)
+	expect(t, n, int64(0))
+}
+
+func TestPeek(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute})
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	store.SetIdMaxAge("id", 10*time.Second)
+	expires := b.count("expire")
+
+	v, found, err := store.Peek("id", "a")
+	expect(t, err, nil)
+	expect(t, found, true)
+	expect(t, v, "1")
+	expect(t, b.ttl("id"), int64(10))
+	expect(t, b.count("expire"), expires)
+
+	v, found, err = store.Peek("id", "missing")
+	expect(t, err, nil)
+	expect(t, found, false)
+	expect(t, v, nil)
+
+	_, found, err = store.Peek("missing", "a")
+	expect(t, err, nil)
+	expect(t, found, false)
+}
+
+func TestSetReportingCreate(t *testing.T) {
+	store, _ := newMemStore(t, Options{})
+
+	created, err := store.SetReportingCreate("id", "a", "1")
+	expect(t, err, nil)
+	expect(t, created, true)
+
+	created, err = store.SetReportingCreate("id", "a", "2")
+	expect(t, err, nil)
+	expect(t, created, false)
+	expect(t, store.Get("id", "a"), "2")
+
+	created, err = store.SetReportingCreate("id", "b", "3")
+	expect(t, err, nil)
+	expect(t, created, true)
+}
+
+type collideA struct{ A int }
+type collideB struct{ B int }
+type renamedA struct{ A int }
+
+func TestGobNameCollision(t *testing.T) {
+	store := &SSDBStore{}
+
+	// take the gob name of collideA by another type
+	rt := reflect.TypeOf(collideA{})
+	gob.RegisterName(rt.PkgPath()+"."+rt.Name(), collideB{})
+
+	_, err := store.serialize(&collideA{1})
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "RegisterTypeName"), true)
+
+	expect(t, RegisterTypeName("ssdbstore.collide.renamedA", renamedA{}), nil)
+	expect(t, RegisterTypeName("ssdbstore.collide.renamedA", renamedA{}), nil)
+	refute(t, RegisterTypeName("ssdbstore.collide.renamedA", collideB{}), nil)
+
+	bs, err := store.serialize(&renamedA{2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := store.deserialize(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, *v.(*renamedA), renamedA{2})
+}
+
+func TestAddCreatesSession(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Minute})
+
+	expect(t, store.Exist("id"), false)
+	expect(t, store.Add("id"), true)
+	expect(t, store.Exist("id"), true)
+	expect(t, b.ttl("id"), int64(60))
+	expect(t, store.Get("id", "a"), nil)
+
+	b.setDown(true)
+	expect(t, store.Add("other"), false)
+}
+
+func TestClearMulti(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+
+	expect(t, store.Set("a", "k", "1"), nil)
+	expect(t, store.Set("b", "k", "1"), nil)
+	expect(t, store.Set("c", "k", "1"), nil)
+
+	n, err := store.ClearMulti([]session.Id{"a", "missing", "c"})
+	expect(t, err, nil)
+	expect(t, n, 2)
+	expect(t, store.Exist("a"), false)
+	expect(t, store.Exist("b"), true)
+	expect(t, store.Exist("c"), false)
+	expect(t, b.count("multi_del"), 1)
+
+	n, err = store.ClearMulti([]session.Id{"missing"})
+	expect(t, err, nil)
+	expect(t, n, 0)
+}
+
+type slowValue struct {
+	Delay time.Duration
+}
+
+func (v slowValue) GobEncode() ([]byte, error) {
+	time.Sleep(v.Delay)
+	return []byte{1}, nil
+}
+
+func (v *slowValue) GobDecode([]byte) error {
+	return nil
+}
+
+func TestSerializeTimeout(t *testing.T) {
+	store, b := newMemStore(t, Options{SerializeTimeout: 20 * time.Millisecond})
+
+	err := store.Set("id", "slow", &slowValue{time.Second})
+	expect(t, err, ErrSerializeTimeout)
+	expect(t, b.count("hset"), 0)
+
+	expect(t, store.Set("id", "fast", &slowValue{}), nil)
+}
+
+type binaryPoint struct {
+	X, Y int32
+}
+
+func (p binaryPoint) MarshalBinary() ([]byte, error) {
+	return []byte{byte(p.X), byte(p.Y)}, nil
+}
+
+func (p *binaryPoint) UnmarshalBinary(data []byte) error {
+	if len(data) != 2 {
+		return fmt.Errorf("bad length %d", len(data))
+	}
+	p.X, p.Y = int32(data[0]), int32(data[1])
+	return nil
+}
+
+func TestSerializeBinaryMarshaler(t *testing.T) {
+	store := &SSDBStore{}
+
+	bs, err := store.serialize(&binaryPoint{3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, bs[0], binaryMarker)
+	expect(t, bytes.HasSuffix(bs, []byte{3, 4}), true)
+
+	v, err := store.deserialize(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, *v.(*binaryPoint), binaryPoint{3, 4})
+
+	bs, err = store.serialize(binaryPoint{5, 6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, bs[0], binaryMarker)
+
+	v, err = store.deserialize(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, v.(binaryPoint), binaryPoint{5, 6})
+}
+
+func TestSerializeGobFallback(t *testing.T) {
+	store := &SSDBStore{}
+
+	bs, err := store.serialize(&Test{1, "xlw"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	refute(t, bs[0], binaryMarker)
+
+	v, err := store.deserialize(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, *v.(*Test), Test{1, "xlw"})
+}
+
+func TestAfterSet(t *testing.T) {
+	var gotKey string
+	var gotSize int
+	store, b := newMemStore(t, Options{
+		AfterSet: func(id session.Id, key string, serializedBytes int) {
+			gotKey, gotSize = key, serializedBytes
+		},
+	})
+
+	want, err := store.serialize("some value")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, store.Set("id", "a", "some value"), nil)
+	expect(t, gotKey, "a")
+	expect(t, gotSize, len(want))
+	raw, _ := b.field("id", "a")
+	expect(t, gotSize, len(raw))
+
+	// failed writes are not reported
+	gotSize = 0
+	b.failWith("hset", errors.New("boom"))
+	refute(t, store.Set("id", "b", "some value"), nil)
+	expect(t, gotSize, 0)
+
+	// the marker of Add is not a user field
+	b.failWith("hset", nil)
+	gotKey = ""
+	expect(t, store.Add("added"), true)
+	expect(t, gotKey, "")
+}
+
+func TestPoolConnectRetries(t *testing.T) {
+	b := newMemBackend()
+	attempts := 0
+	oldPool, oldSleep := newPool, sleep
+	newPool = func(cfg *gossdb.Config) (connector, error) {
+		attempts++
+		if attempts <= 2 {
+			return nil, errors.New("connection refused")
+		}
+		return memPool{b}, nil
+	}
+	var waits []time.Duration
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { newPool, sleep = oldPool, oldSleep }()
+
+	_, err := New(Options{PoolConnectRetries: 1, PoolConnectBackoff: time.Second})
+	refute(t, err, nil)
+	expect(t, attempts, 2)
+
+	attempts = 0
+	waits = nil
+	store, err := New(Options{PoolConnectRetries: 3, PoolConnectBackoff: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, attempts, 3)
+	expect(t, len(waits), 2)
+	expect(t, waits[1], 2*time.Second)
+	expect(t, store.Set("id", "a", "1"), nil)
+}
+
+func TestLargeValueLog(t *testing.T) {
+	store, _ := newMemStore(t, Options{LargeValueLogThreshold: 100})
+	logger := newMemLogger()
+	store.Logger = logger
+
+	expect(t, store.Set("id", "small", "tiny"), nil)
+	expect(t, store.Get("id", "small"), "tiny")
+	expect(t, len(logger.get("info")), 0)
+
+	large := strings.Repeat("x", 200)
+	expect(t, store.Set("id", "large", large), nil)
+	expect(t, store.Get("id", "large"), large)
+	infos := logger.get("info")
+	expect(t, len(infos), 2)
+	expect(t, strings.HasPrefix(infos[0], "ssdb session id: writing large value of"), true)
+	expect(t, strings.HasPrefix(infos[1], "ssdb session id: read large value of"), true)
+	expect(t, strings.HasSuffix(infos[1], `for "large"`), true)
+}
+
+func TestMinTTL(t *testing.T) {
+	store, b := newMemStore(t, Options{MaxAge: time.Hour, MinTTL: time.Minute})
+	logger := newMemLogger()
+	store.Logger = logger
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, b.ttl("id"), int64(3600))
+	expect(t, len(logger.get("warn")), 0)
+
+	expect(t, store.SetWithMaxAge("id", "a", "1", 5*time.Second), nil)
+	expect(t, b.ttl("id"), int64(60))
+	expect(t, len(logger.get("warn")), 1)
+
+	expect(t, store.SetWithMaxAge("id", "a", "1", 2*time.Hour), nil)
+	expect(t, b.ttl("id"), int64(7200))
+
+	store.SetIdMaxAge("id", time.Second)
+	expect(t, b.ttl("id"), int64(60))
+
+	store.SetMaxAge(10 * time.Second)
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, b.ttl("id"), int64(60))
+	expect(t, len(logger.get("warn")), 3)
+
+	// a MaxAge below MinTTL is logged once, not on every request
+	expect(t, store.Set("id", "a", "1"), nil)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, len(logger.get("warn")), 3)
+
+	// explicit maxAges are logged on every call
+	expect(t, store.SetWithMaxAge("id", "a", "1", 5*time.Second), nil)
+	expect(t, store.SetWithMaxAge("id", "a", "1", 5*time.Second), nil)
+	expect(t, len(logger.get("warn")), 5)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, len(logger.get("warn")), 5)
+
+	store.SetMaxAge(20 * time.Second)
+	expect(t, store.Get("id", "a"), "1")
+	expect(t, b.ttl("id"), int64(60))
+	expect(t, len(logger.get("warn")), 6)
+}
+
+func TestPoolSizing(t *testing.T) {
+	var cfgs []*gossdb.Config
+	old := newPool
+	newPool = func(cfg *gossdb.Config) (connector, error) {
+		cfgs = append(cfgs, cfg)
+		return memPool{newMemBackend()}, nil
+	}
+	defer func() { newPool = old }()
+
+	store, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, cfgs[0].MinPoolSize, 5)
+	expect(t, cfgs[0].MaxPoolSize, 50)
+	expect(t, cfgs[0].AcquireIncrement, 5)
+	expect(t, store.EffectiveOptions().MaxPoolSize, 50)
+
+	_, err = New(Options{MinPoolSize: 20, MaxPoolSize: 500, AcquireIncrement: 10, StandbyHost: "standby"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range cfgs[1:] {
+		expect(t, cfg.MinPoolSize, 20)
+		expect(t, cfg.MaxPoolSize, 500)
+		expect(t, cfg.AcquireIncrement, 10)
+	}
+
+	_, err = New(Options{MinPoolSize: 100, MaxPoolSize: 10})
+	refute(t, err, nil)
+	expect(t, len(cfgs), 3)
+}
+
+func TestVerifyClear(t *testing.T) {
+	store, b := newMemStore(t, Options{VerifyClear: true})
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	b.failCall("del", 1)
+	expect(t, store.Clear("id"), true)
+	expect(t, b.count("del"), 2)
+	expect(t, store.Exist("id"), false)
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	b.failWith("del", errBackendDown)
+	expect(t, store.Clear("id"), false)
+	_, err := store.ClearCount("id")
+	expect(t, errors.Is(err, ErrNotCleared), true)
+	expect(t, errors.Is(err, errBackendDown), true)
+	var be *BackendError
+	expect(t, errors.As(err, &be), true)
+	expect(t, errors.Is(err, ErrUnknown), true)
+	expect(t, store.Exist("id"), true)
+
+	// without the option the first failure is final
+	store.VerifyClear = false
+	b.failWith("del", nil)
+	b.failCall("del", 1)
+	expect(t, store.Clear("id"), false)
+	expect(t, store.Exist("id"), true)
+}
+
+func TestExistE(t *testing.T) {
+	store, b := newMemStore(t, Options{})
+	expect(t, store.Set("present", "a", "1"), nil)
+
+	has, err := store.ExistE("present")
+	expect(t, err, nil)
+	expect(t, has, true)
+
+	has, err = store.ExistE("absent")
+	expect(t, err, nil)
+	expect(t, has, false)
+
+	b.failWith("exists", errBackendDown)
+	_, err = store.ExistE("present")
+	expect(t, errors.Is(err, errBackendDown), true)
+	expect(t, store.Exist("present"), false)
+
+	b.failWith("exists", nil)
+	b.setDown(true)
+	_, err = store.ExistE("present")
+	expect(t, errors.Is(err, errBackendDown), true)
+}
+
 /* Test Helpers */
 func expect(t *testing.T, a interface{}, b interface{}) {
 	if a != b {
@@ -0,0 +1,92 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errPrimaryPing = errors.New("primary ping failed")
+
+// standby tracks the health of the primary backend and decides when the
+// warm standby should serve requests instead. Switching in either
+// direction only happens once the new state has lasted for grace, so a
+// flapping primary does not bounce traffic between the two. While
+// promoted the primary is probed at most once per grace, so requests do
+// not wait for an unreachable primary to time out.
+type standby struct {
+	pool  connector
+	grace time.Duration
+
+	lock      sync.Mutex
+	promoted  bool
+	downSince time.Time // first failure of the primary, zero while healthy
+	upSince   time.Time // first success of the primary while promoted
+	probedAt  time.Time // last probe of the primary while promoted
+}
+
+func (f *standby) isPromoted() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.promoted
+}
+
+// conn probes primary and returns a client of whichever backend should
+// serve the request at now, reporting whether it is the standby. While
+// the primary is failing but the grace period has not passed yet, the
+// primary's error is returned.
+func (f *standby) conn(primary connector, now time.Time) (client, bool, error) {
+	f.lock.Lock()
+	skip := f.promoted && now.Sub(f.probedAt) < f.grace
+	if f.promoted && !skip {
+		f.probedAt = now
+	}
+	f.lock.Unlock()
+	if skip {
+		c, err := f.pool.NewClient()
+		return c, true, err
+	}
+
+	c, err := primary.NewClient()
+	if err == nil && f.isPromoted() && !c.Ping() {
+		c.Close()
+		c, err = nil, errPrimaryPing
+	}
+
+	f.lock.Lock()
+	if err != nil {
+		f.upSince = time.Time{}
+		if f.downSince.IsZero() {
+			f.downSince = now
+		}
+		if !f.promoted && now.Sub(f.downSince) >= f.grace {
+			f.promoted = true
+			f.probedAt = now
+		}
+	} else {
+		f.downSince = time.Time{}
+		if f.promoted {
+			if f.upSince.IsZero() {
+				f.upSince = now
+			}
+			if now.Sub(f.upSince) >= f.grace {
+				f.promoted = false
+			}
+		}
+	}
+	promoted := f.promoted
+	f.lock.Unlock()
+
+	if !promoted {
+		return c, false, err
+	}
+	if c != nil {
+		c.Close()
+	}
+	c, err = f.pool.NewClient()
+	return c, true, err
+}
@@ -0,0 +1,108 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestStandbyPromotion(t *testing.T) {
+	primary, backup := newMemBackend(), newMemBackend()
+	usePools(t, map[string]*memBackend{"primary": primary, "standby": backup})
+
+	store, err := New(Options{
+		Host:           "primary",
+		StandbyHost:    "standby",
+		PromotionGrace: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := newFakeClock()
+	store.clock = clock
+	id := session.Id("standby")
+
+	expect(t, store.Set(id, "a", "1"), nil)
+	_, ok := primary.field("standby", "a")
+	expect(t, ok, true)
+
+	// the primary fails, but requests keep failing until the grace passed
+	primary.setDown(true)
+	refute(t, store.Set(id, "b", "2"), nil)
+	clock.Advance(9 * time.Second)
+	refute(t, store.Set(id, "b", "2"), nil)
+
+	clock.Advance(time.Second)
+	expect(t, store.Set(id, "b", "2"), nil)
+	_, ok = backup.field("standby", "b")
+	expect(t, ok, true)
+
+	// the primary recovers, the standby keeps serving and the primary is
+	// not even dialed until the next probe is due
+	primary.setDown(false)
+	dials := primary.count("connect")
+	expect(t, store.Set(id, "c", "3"), nil)
+	_, ok = backup.field("standby", "c")
+	expect(t, ok, true)
+
+	clock.Advance(5 * time.Second)
+	primary.setDown(true)
+	expect(t, store.Set(id, "d", "4"), nil)
+	primary.setDown(false)
+	expect(t, store.Set(id, "d", "4"), nil)
+	_, ok = primary.field("standby", "d")
+	expect(t, ok, false)
+	expect(t, primary.count("connect"), dials)
+
+	// the first probe finds the primary healthy, the one a grace later
+	// switches back
+	clock.Advance(5 * time.Second)
+	expect(t, store.Set(id, "e", "5"), nil)
+	_, ok = backup.field("standby", "e")
+	expect(t, ok, true)
+	expect(t, primary.count("connect"), dials+1)
+
+	clock.Advance(10 * time.Second)
+	expect(t, store.Set(id, "f", "6"), nil)
+	_, ok = primary.field("standby", "f")
+	expect(t, ok, true)
+	_, ok = backup.field("standby", "f")
+	expect(t, ok, false)
+}
+
+func TestGetFromNode(t *testing.T) {
+	primary, backup := newMemBackend(), newMemBackend()
+	usePools(t, map[string]*memBackend{"primary": primary, "standby": backup})
+
+	store, err := New(Options{
+		Host:           "primary",
+		StandbyHost:    "standby",
+		StandbyPort:    6381,
+		PromotionGrace: time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := newFakeClock()
+	store.clock = clock
+
+	expect(t, store.Set("id", "a", "1"), nil)
+	v, node, err := store.GetFromNode("id", "a")
+	expect(t, err, nil)
+	expect(t, v, "1")
+	expect(t, node, "primary:6380")
+
+	primary.setDown(true)
+	_, _, err = store.GetFromNode("id", "a")
+	refute(t, err, nil)
+	clock.Advance(time.Second)
+	v, node, err = store.GetFromNode("id", "a")
+	expect(t, err, nil)
+	expect(t, v, nil)
+	expect(t, node, "standby:6381")
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"reflect"
+	"sync"
+)
+
+// transientFields caches, per struct type, the indexes of the exported
+// fields tagged `session:"-"`.
+var transientFields sync.Map
+
+func transientIndexes(t reflect.Type) []int {
+	if idx, ok := transientFields.Load(t); ok {
+		return idx.([]int)
+	}
+	var idx []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath == "" && f.Tag.Get("session") == "-" {
+			idx = append(idx, i)
+		}
+	}
+	transientFields.Store(t, idx)
+	return idx
+}
+
+// stripTransient returns a copy of a struct pointer with the fields tagged
+// `session:"-"` zeroed, leaving the caller's value untouched. Since gob
+// does not transmit zero values, such fields read back as their zero
+// value, which is indistinguishable from a stored zero. Only the top level
+// fields of the pointed to struct are considered, not nested structs.
+func stripTransient(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return value
+	}
+	idx := transientIndexes(v.Elem().Type())
+	if len(idx) == 0 {
+		return value
+	}
+
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	for _, i := range idx {
+		f := cp.Elem().Field(i)
+		f.Set(reflect.Zero(f.Type()))
+	}
+	return cp.Interface()
+}
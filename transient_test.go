@@ -0,0 +1,29 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import "testing"
+
+type transientUser struct {
+	Name  string
+	Token string `session:"-"`
+}
+
+func TestTransientFields(t *testing.T) {
+	store := &SSDBStore{}
+	user := &transientUser{Name: "xlw", Token: "secret"}
+
+	bs, err := store.serialize(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, user.Token, "secret")
+
+	v, err := store.deserialize(bs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(t, *v.(*transientUser), transientUser{Name: "xlw"})
+}
@@ -0,0 +1,34 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"fmt"
+
+	"github.com/tango-contrib/session"
+)
+
+// StrongIdValidator returns an Options.IdValidator accepting ids of at least
+// minLength bytes made of at least minDistinct different bytes, the
+// latter being a cheap guard against low entropy ids like "aaaa...".
+func StrongIdValidator(minLength, minDistinct int) func(session.Id) error {
+	return func(id session.Id) error {
+		if len(id) < minLength {
+			return fmt.Errorf("%w: %d bytes, at least %d required", ErrWeakId, len(id), minLength)
+		}
+		var seen [256]bool
+		distinct := 0
+		for i := 0; i < len(id); i++ {
+			if !seen[id[i]] {
+				seen[id[i]] = true
+				distinct++
+			}
+		}
+		if distinct < minDistinct {
+			return fmt.Errorf("%w: %d distinct bytes, at least %d required", ErrWeakId, distinct, minDistinct)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2015 The Tango Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ssdbstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tango-contrib/session"
+)
+
+func TestIdValidator(t *testing.T) {
+	store, b := newMemStore(t, Options{IdValidator: StrongIdValidator(16, 8)})
+
+	strong := session.Id("3f9a1c0e7b2d4a68")
+	expect(t, store.Add(strong), true)
+	expect(t, store.Set(strong, "a", "1"), nil)
+
+	for _, weak := range []session.Id{"short", "aaaaaaaaaaaaaaaaaaaa", "abababababababab"} {
+		expect(t, store.Add(weak), false)
+		err := store.Set(weak, "a", "1")
+		expect(t, errors.Is(err, ErrWeakId), true)
+	}
+	expect(t, b.count("hset"), 2) // the marker of Add and the Set
+}
+
+func TestIdValidatorWrapsErrors(t *testing.T) {
+	store, _ := newMemStore(t, Options{IdValidator: func(id session.Id) error {
+		return errors.New("nope")
+	}})
+
+	err := store.Set("id", "a", "1")
+	expect(t, errors.Is(err, ErrWeakId), true)
+}